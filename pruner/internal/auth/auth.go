@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/saidsef/pod-pruner/pruner/utils"
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -28,6 +30,7 @@ import (
 // KubernetesClientManager manages the Kubernetes client creation and caching.
 type KubernetesClientManager struct {
 	clientset *kubernetes.Clientset
+	dynamic   dynamic.Interface
 	once      sync.Once
 	log       *logrus.Logger
 }
@@ -61,6 +64,8 @@ func (m *KubernetesClientManager) GetKubernetesClient() (*kubernetes.Clientset,
 			m.log.Error(err)
 			return
 		}
+		// Make pod-pruner's requests identifiable in API server audit logs.
+		config.UserAgent = utils.UserAgent()
 
 		m.clientset, err = kubernetes.NewForConfig(config)
 		if err != nil {
@@ -69,6 +74,13 @@ func (m *KubernetesClientManager) GetKubernetesClient() (*kubernetes.Clientset,
 			return
 		}
 
+		m.dynamic, err = dynamic.NewForConfig(config)
+		if err != nil {
+			err = fmt.Errorf("unable to create dynamic client for in-cluster Kubernetes config: %w", err)
+			m.log.Error(err)
+			return
+		}
+
 		m.log.Info("Successfully created Kubernetes clientset")
 	})
 
@@ -78,3 +90,16 @@ func (m *KubernetesClientManager) GetKubernetesClient() (*kubernetes.Clientset,
 
 	return m.clientset, nil
 }
+
+// GetDynamicClient returns a dynamic Kubernetes client for custom resources, sharing
+// the in-cluster configuration of GetKubernetesClient and creating both if needed.
+//
+// Returns:
+// - A dynamic.Interface if successful.
+// - An error if there was an issue creating the client or retrieving the configuration.
+func (m *KubernetesClientManager) GetDynamicClient() (dynamic.Interface, error) {
+	if _, err := m.GetKubernetesClient(); err != nil {
+		return nil, err
+	}
+	return m.dynamic, nil
+}
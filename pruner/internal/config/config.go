@@ -0,0 +1,739 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds every setting of the pruner, resolved once at startup from
+// environment variables.
+type Config struct {
+	DryRun                   bool                     // DryRun indicates whether deletions are only logged (DRY_RUN).
+	DryRunVerbose            bool                     // DryRunVerbose logs the decision for every pod in dry run mode (DRY_RUN_VERBOSE).
+	Resources                []string                 // Resources is the list of resource types to prune (RESOURCES).
+	Namespaces               []string                 // Namespaces is the explicit list of namespaces to prune (NAMESPACES).
+	NamespaceSelector        string                   // NamespaceSelector discovers additional namespaces by label (NAMESPACE_SELECTOR).
+	RequireOptIn             bool                     // RequireOptIn only prunes namespaces annotated pod-pruner.saidsef.co.uk/enabled=true (REQUIRE_OPT_IN).
+	NamespaceMinAge          time.Duration            // NamespaceMinAge skips namespaces younger than this, 0 when disabled (NAMESPACE_MIN_AGE).
+	AllowSystemNamespaces    bool                     // AllowSystemNamespaces allows pruning in kube-* namespaces (ALLOW_SYSTEM_NAMESPACES).
+	NamespaceConcurrency     int                      // NamespaceConcurrency is the number of namespaces processed in parallel (NAMESPACE_CONCURRENCY).
+	DeleteConcurrency        int                      // DeleteConcurrency is the maximum number of concurrent delete calls (DELETE_CONCURRENCY).
+	GlobalDeleteConcurrency  int                      // GlobalDeleteConcurrency caps concurrent delete calls across the whole process, 0 to disable (GLOBAL_DELETE_CONCURRENCY).
+	ResourceConcurrency      int                      // ResourceConcurrency is the number of resource types processed in parallel per namespace (RESOURCE_CONCURRENCY).
+	DeletionOrder            []string                 // DeletionOrder is the order resource types are processed in within a namespace (DELETION_ORDER).
+	NamespaceOverrides       NamespaceOverrides       // NamespaceOverrides overrides delete concurrency and order by namespace (NAMESPACE_OVERRIDES_FILE).
+	ReconcileTimeout         time.Duration            // ReconcileTimeout bounds a whole reconcile cycle, 0 when unbounded (RECONCILE_TIMEOUT).
+	ShutdownGrace            time.Duration            // ShutdownGrace is how long in-flight namespaces may finish after SIGTERM (SHUTDOWN_GRACE).
+	ListMaxRetries           int                      // ListMaxRetries is the number of times a failed listing is retried within a cycle (LIST_MAX_RETRIES).
+	SlowListThreshold        time.Duration            // SlowListThreshold scans namespaces listing slower than this less often, 0 when disabled (SLOW_LIST_THRESHOLD).
+	SlowListMaxPeriod        int                      // SlowListMaxPeriod caps the number of cycles between two scans of a slow namespace (SLOW_LIST_MAX_PERIOD).
+	NamespaceHourlyBudget    int                      // NamespaceHourlyBudget caps deletions per namespace per hour, 0 when unlimited (NAMESPACE_HOURLY_BUDGET).
+	BudgetStateConfigMap     string                   // BudgetStateConfigMap is the "namespace/name" of the ConfigMap the budget is persisted to (BUDGET_STATE_CONFIGMAP).
+	BudgetStateFile          string                   // BudgetStateFile is the path of the file the budget is persisted to (BUDGET_STATE_FILE).
+	BudgetFlushInterval      time.Duration            // BudgetFlushInterval is how often the persisted budget is updated (BUDGET_FLUSH_INTERVAL).
+	DeleteRatePerSec         float64                  // DeleteRatePerSec caps deletions per second, 0 when unlimited (DELETE_RATE_PER_SEC).
+	DeleteRetryBaseDelay     time.Duration            // DeleteRetryBaseDelay is the first delay before retrying a throttled delete (DELETE_RETRY_BASE_DELAY).
+	DeleteRetryMaxDelay      time.Duration            // DeleteRetryMaxDelay caps the delay between delete retries (DELETE_RETRY_MAX_DELAY).
+	VerifyDeletion           bool                     // VerifyDeletion only counts deletions as pruned once the object is gone (VERIFY_DELETION).
+	VerifyDeletionTimeout    time.Duration            // VerifyDeletionTimeout bounds how long each deletion is verified for (VERIFY_DELETION_TIMEOUT).
+	KillSwitchConfigMap      string                   // KillSwitchConfigMap is the "namespace/name" of the ConfigMap disabling deletions (KILL_SWITCH_CONFIGMAP).
+	SkipDuringUpgrade        float64                  // SkipDuringUpgrade skips deletions once this fraction of nodes is cordoned, 0 when disabled (SKIP_DURING_UPGRADE).
+	TriggerToken             string                   // TriggerToken enables the POST /reconcile endpoint when set (TRIGGER_TOKEN).
+	LabelSelector            labels.Selector          // LabelSelector is the fallback of POD_LABEL_SELECTOR and JOB_LABEL_SELECTOR, nil when unset (LABEL_SELECTOR).
+	PodLabelSelector         labels.Selector          // PodLabelSelector restricts pruning to pods with matching labels, nil when unset (POD_LABEL_SELECTOR).
+	JobLabelSelector         labels.Selector          // JobLabelSelector restricts pruning to jobs with matching labels, nil when unset (JOB_LABEL_SELECTOR).
+	PodMinAge                time.Duration            // PodMinAge protects pods younger than this, 0 when disabled (POD_MIN_AGE).
+	NodeName                 string                   // NodeName only lists pods bound to this node, empty for every node (NODE_NAME).
+	PodName                  string                   // PodName is the name of pod-pruner's own pod, never pruned (POD_NAME).
+	PodNamespace             string                   // PodNamespace is the namespace of pod-pruner's own pod (POD_NAMESPACE).
+	DaemonSetMode            bool                     // DaemonSetMode restricts every resource type to pods on NODE_NAME (DAEMONSET_MODE).
+	ContainerStatuses        []string                 // ContainerStatuses is the list of container reasons to prune (CONTAINER_STATUSES).
+	StatusMatchMode          string                   // StatusMatchMode is either "exact" or "regex" (STATUS_MATCH_MODE).
+	ContainerMessageContains []string                 // ContainerMessageContains requires CONTAINER_STATUSES matches to have a message containing one of these (CONTAINER_MESSAGE_CONTAINS).
+	StatusPatterns           []*regexp.Regexp         // StatusPatterns holds the CONTAINER_STATUSES entries matched as regular expressions.
+	PodConditions            []PodCondition           // PodConditions selects pods carrying any of these conditions (POD_CONDITIONS).
+	UseLastTermination       bool                     // UseLastTermination also matches the reason of the previous container termination (USE_LAST_TERMINATION).
+	ContainerGranularity     string                   // ContainerGranularity is "pod" or "container" (CONTAINER_GRANULARITY).
+	StatusMatchAll           bool                     // StatusMatchAll requires every container of a pod to match (STATUS_MATCH_ALL).
+	PodTTLAfterFinished      time.Duration            // PodTTLAfterFinished prunes terminal pods after this TTL, 0 when disabled (POD_TTL_AFTER_FINISHED).
+	LastTerminationTTL       time.Duration            // LastTerminationTTL delays CONTAINER_STATUSES matches until the last container death is this old (LAST_TERMINATION_TTL).
+	CrashLoopMinDuration     time.Duration            // CrashLoopMinDuration prunes pods crash looping for longer than this, 0 when disabled (CRASHLOOP_MIN_DURATION).
+	ImagePullMinAge          time.Duration            // ImagePullMinAge prunes pods failing to pull an image for longer than this, 0 when disabled (IMAGE_PULL_MIN_AGE).
+	PendingTTL               time.Duration            // PendingTTL is how long a pod may stay Pending with PENDING_PODS (PENDING_TTL).
+	PendingUnschedulableOnly bool                     // PendingUnschedulableOnly restricts PENDING_PODS to pods with PodScheduled=False (PENDING_UNSCHEDULABLE_ONLY).
+	NotReadyTTL              time.Duration            // NotReadyTTL is how long a started container may stay not Ready with NOTREADY_PODS (NOT_READY_TTL).
+	MaxRestartRate           float64                  // MaxRestartRate prunes containers restarting more often per hour, 0 when disabled (MAX_RESTART_RATE).
+	SchedulerNameExclude     []string                 // SchedulerNameExclude lists schedulers whose pods are never pruned (SCHEDULER_NAME_EXCLUDE).
+	SkipIfAnyRunning         bool                     // SkipIfAnyRunning leaves pods with a running container alone (SKIP_IF_ANY_RUNNING).
+	SkipPVCMounters          bool                     // SkipPVCMounters protects pods referencing a PersistentVolumeClaim (SKIP_PVC_MOUNTERS).
+	RespectMinReady          bool                     // RespectMinReady protects pods younger than their owner's minReadySeconds (RESPECT_MIN_READY).
+	SkipServiceEndpoints     bool                     // SkipServiceEndpoints protects pods that are ready endpoints of a Service (SKIP_SERVICE_ENDPOINTS).
+	OnlyOrphans              bool                     // OnlyOrphans restricts pruning to pods without owners (ONLY_ORPHANS).
+	SkipControlledPods       bool                     // SkipControlledPods protects pods with owners, refined by ProtectedOwnerKinds (SKIP_CONTROLLED_PODS).
+	ProtectedOwnerKinds      []string                 // ProtectedOwnerKinds protects pods owned by these kinds (PROTECTED_OWNER_KINDS).
+	DeleteImageAllowlist     []*regexp.Regexp         // DeleteImageAllowlist restricts pruning to pods running a matching image (DELETE_IMAGE_ALLOWLIST).
+	DeleteImageDenylist      []*regexp.Regexp         // DeleteImageDenylist protects pods running a matching image (DELETE_IMAGE_DENYLIST).
+	ProtectAnnotation        string                   // ProtectAnnotation opts pods and jobs annotated with it set to "true" out of pruning (PROTECT_ANNOTATION).
+	SelectionAnnotation      string                   // SelectionAnnotation is the annotation recording why a pod was selected, empty when disabled (SELECTION_ANNOTATION).
+	FinalizerAllowlist       []string                 // FinalizerAllowlist is the list of finalizers removed from pods before they are deleted (FINALIZER_ALLOWLIST).
+	JobStatuses              []string                 // JobStatuses is the list of job condition types to prune (JOB_STATUSES).
+	JobTTL                   time.Duration            // JobTTL delays job pruning after a matching condition (JOB_TTL).
+	JobMaxAge                time.Duration            // JobMaxAge selects jobs older than this whatever their conditions, 0 when disabled (JOB_MAX_AGE).
+	JobInformer              bool                     // JobInformer enables event-driven job pruning (JOB_INFORMER).
+	ConfigMapTTL             time.Duration            // ConfigMapTTL is the minimum age of an unreferenced ConfigMap before it is pruned (CONFIGMAP_TTL).
+	ResourceTTLs             map[string]time.Duration // ResourceTTLs sets the TTLs above by resource type, keyed as in ResourceTTLKeys (RESOURCE_TTLS).
+	Port                     string                   // Port is the metrics server port (PORT).
+	MetricsAuthToken         string                   // MetricsAuthToken is the bearer token scrapes of /metrics must send, empty for none (METRICS_AUTH_TOKEN).
+	MetricsRequired          bool                     // MetricsRequired exits when the metrics server cannot listen instead of retrying (METRICS_REQUIRED).
+	MetricsNamespace         string                   // MetricsNamespace is the prefix of every metric name, empty for none (METRICS_NAMESPACE).
+	MetricsLegacyNames       bool                     // MetricsLegacyNames drops the metric name prefix for existing dashboards (METRICS_LEGACY_NAMES).
+	MetricsStateLabels       []string                 // MetricsStateLabels lists the reasons kept as state label values, others are "other" (METRICS_STATE_LABELS).
+	HeartbeatFile            string                   // HeartbeatFile is touched after every successful cycle when set (HEARTBEAT_FILE).
+	PushgatewayURL           string                   // PushgatewayURL enables pushing the final metrics on exit when set (PUSHGATEWAY_URL).
+	PushgatewayJob           string                   // PushgatewayJob is the job label metrics are pushed under (PUSHGATEWAY_JOB).
+	StatusCR                 string                   // StatusCR is the name of the PrunePolicy whose status reflects every cycle (STATUS_CR).
+	PlanOutput               string                   // PlanOutput prints a single dry run cycle as a plan in this format and exits, empty when disabled (PLAN_OUTPUT).
+	PlanInput                string                   // PlanInput is the path of an approved plan to apply once before exiting, empty when disabled (PLAN_INPUT).
+	BaselinePlan             string                   // BaselinePlan is the path of a plan a single dry run cycle is diffed against before exiting, empty when disabled (BASELINE_PLAN).
+	AuditSinkAddr            string                   // AuditSinkAddr receives an NDJSON record of every deletion, empty when disabled (AUDIT_SINK_ADDR).
+	LogResourceTemplate      *template.Template       // LogResourceTemplate renders resources in logs, nil for the built-in format (LOG_RESOURCE_TEMPLATE).
+	NotifyWebhookURL         string                   // NotifyWebhookURL receives a JSON summary of every cycle (NOTIFY_WEBHOOK_URL).
+	NotifyTimeout            time.Duration            // NotifyTimeout bounds each notification request (NOTIFY_TIMEOUT).
+	NotifyMaxItems           int                      // NotifyMaxItems caps the resources listed in a notification (NOTIFY_MAX_ITEMS).
+	SMTPHost                 string                   // SMTPHost enables the email notifier when set (SMTP_HOST).
+	SMTPPort                 string                   // SMTPPort is the port of the SMTP server (SMTP_PORT).
+	SMTPFrom                 string                   // SMTPFrom is the sender address of notification emails (SMTP_FROM).
+	SMTPTo                   []string                 // SMTPTo is the list of recipients of notification emails (SMTP_TO).
+	SMTPUsername             string                   // SMTPUsername enables PLAIN authentication when set (SMTP_USERNAME).
+	SMTPPassword             string                   // SMTPPassword is the password used for authentication (SMTP_PASSWORD).
+	SMTPTLS                  string                   // SMTPTLS is one of "starttls", "tls" or "none" (SMTP_TLS).
+
+	settings []Setting
+}
+
+// ResourceTypes lists every resource type RESOURCES may include, in the default
+// DELETION_ORDER. Jobs come before pods so deleting a job's pods first does not get
+// them recreated by the job.
+var ResourceTypes = []string{"JOBS", "PODS", "PENDING_PODS", "NOTREADY_PODS", "ORPHANED_NODE_PODS", "ORPHAN_JOB_PODS", "ORPHAN_CONFIGMAPS"}
+
+// NodeLocalResources lists the resource types that only select pods bound to NODE_NAME,
+// the only ones allowed with DAEMONSET_MODE.
+var NodeLocalResources = []string{"PODS", "PENDING_PODS", "NOTREADY_PODS", "ORPHAN_JOB_PODS"}
+
+// JobConditionTypes lists the job condition types JOB_STATUSES may select. Complete
+// and Failed are terminal: the job and its pods are finished. FailureTarget and
+// SuccessCriteriaMet are set while the job's pods are still terminating, before
+// Failed or Complete is added. Suspended is not accepted: a suspended job is only
+// paused and can be resumed.
+var JobConditionTypes = []string{"Complete", "Failed", "FailureTarget", "SuccessCriteriaMet"}
+
+// ResourceTTLKeys maps every key RESOURCE_TTLS may include to the setting its
+// duration replaces.
+var ResourceTTLKeys = map[string]string{
+	"jobs":             "JOB_TTL",
+	"job_max_age":      "JOB_MAX_AGE",
+	"finished_pods":    "POD_TTL_AFTER_FINISHED",
+	"last_termination": "LAST_TERMINATION_TTL",
+	"crashloop":        "CRASHLOOP_MIN_DURATION",
+	"image_pull":       "IMAGE_PULL_MIN_AGE",
+	"pending_pods":     "PENDING_TTL",
+	"not_ready":        "NOT_READY_TTL",
+	"configmaps":       "CONFIGMAP_TTL",
+}
+
+// defaultStateLabels are the reasons kept as state label values unless
+// METRICS_STATE_LABELS overrides them.
+var defaultStateLabels = []string{
+	"Completed", "ContainerCannotRun", "CrashLoopBackOff", "CreateContainerConfigError", "CreateContainerError",
+	"DeadlineExceeded", "ErrImagePull", "Error", "Evicted", "Failed", "HighRestartRate", "ImagePullBackOff",
+	"InvalidImageName", "NodeLost", "OOMKilled", "Succeeded", "Unschedulable",
+}
+
+// metricNamespacePattern matches a valid METRICS_NAMESPACE, which is joined to every
+// metric name with an underscore.
+var metricNamespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Setting describes a single resolved configuration value and where it came from.
+type Setting struct {
+	Key    string // Key is the name of the environment variable.
+	Value  string // Value is the effective value, redacted for secrets.
+	Source string // Source is either "env", "default" or "RESOURCE_TTLS".
+}
+
+// NamespaceOverride overrides global settings for a single namespace, as read from
+// NAMESPACE_OVERRIDES_FILE. Unset fields fall back to the global settings.
+type NamespaceOverride struct {
+	DeleteConcurrency int      `json:"deleteConcurrency,omitempty"` // DeleteConcurrency caps concurrent delete calls in the namespace, within DELETE_CONCURRENCY.
+	DeletionOrder     []string `json:"deletionOrder,omitempty"`     // DeletionOrder replaces DELETION_ORDER in the namespace.
+}
+
+// NamespaceOverrides maps namespace names to their NamespaceOverride.
+type NamespaceOverrides map[string]NamespaceOverride
+
+// ForNamespace returns the configuration a namespace is pruned with, with its
+// NAMESPACE_OVERRIDES_FILE entry applied. DeleteConcurrency overrides are applied by
+// the DeleteLimiter instead.
+//
+// Parameters:
+// - namespace: The namespace to resolve the configuration of.
+//
+// Returns:
+// - A copy of the configuration with the namespace overrides applied.
+func (c Config) ForNamespace(namespace string) Config {
+	c.DeletionOrder = c.DeletionOrderOf(namespace)
+	return c
+}
+
+// DeletionOrderOf returns the order resource types are processed in within a namespace.
+//
+// Parameters:
+// - namespace: The namespace to resolve the order of.
+//
+// Returns:
+// - The deletionOrder override of the namespace if set, DELETION_ORDER otherwise.
+func (c Config) DeletionOrderOf(namespace string) []string {
+	if override := c.NamespaceOverrides[namespace]; len(override.DeletionOrder) > 0 {
+		return override.DeletionOrder
+	}
+	return c.DeletionOrder
+}
+
+// PodCondition matches a pod condition by type and status, and optionally reason.
+type PodCondition struct {
+	Type   string // Type is the condition type (e.g., PodScheduled).
+	Status string // Status is the condition status, True, False or Unknown.
+	Reason string // Reason is the condition reason (e.g., Unschedulable), empty to match any.
+}
+
+// String renders the condition in the POD_CONDITIONS format "Type=Status[:Reason]".
+func (c PodCondition) String() string {
+	if c.Reason == "" {
+		return fmt.Sprintf("%s=%s", c.Type, c.Status)
+	}
+	return fmt.Sprintf("%s=%s:%s", c.Type, c.Status, c.Reason)
+}
+
+// LoadConfig resolves the configuration from environment variables, applying
+// defaults for anything unset, and validates the result.
+//
+// Returns:
+// - The resolved Config.
+// - An error describing every invalid setting, if any.
+func LoadConfig() (Config, error) {
+	l := &loader{}
+	ttls := l.durationMap("RESOURCE_TTLS", ResourceTTLKeys)
+	selector := l.selector("LABEL_SELECTOR", nil)
+	cfg := Config{
+		DryRun:                   l.bool("DRY_RUN", true),
+		DryRunVerbose:            l.bool("DRY_RUN_VERBOSE", false),
+		Resources:                l.list("RESOURCES", "PODS"),
+		Namespaces:               l.list("NAMESPACES", ""),
+		NamespaceSelector:        l.string("NAMESPACE_SELECTOR", ""),
+		RequireOptIn:             l.bool("REQUIRE_OPT_IN", false),
+		NamespaceMinAge:          l.duration("NAMESPACE_MIN_AGE", 0),
+		AllowSystemNamespaces:    l.bool("ALLOW_SYSTEM_NAMESPACES", false),
+		NamespaceConcurrency:     l.positiveInt("NAMESPACE_CONCURRENCY", 1),
+		DeleteConcurrency:        l.positiveInt("DELETE_CONCURRENCY", 10),
+		GlobalDeleteConcurrency:  l.nonNegativeInt("GLOBAL_DELETE_CONCURRENCY", 0),
+		ResourceConcurrency:      l.positiveInt("RESOURCE_CONCURRENCY", 1),
+		DeletionOrder:            l.list("DELETION_ORDER", strings.Join(ResourceTypes, ",")),
+		NamespaceOverrides:       l.namespaceOverrides("NAMESPACE_OVERRIDES_FILE"),
+		ReconcileTimeout:         l.duration("RECONCILE_TIMEOUT", 0),
+		ShutdownGrace:            l.duration("SHUTDOWN_GRACE", 0),
+		ListMaxRetries:           l.nonNegativeInt("LIST_MAX_RETRIES", 2),
+		SlowListThreshold:        l.duration("SLOW_LIST_THRESHOLD", 0),
+		SlowListMaxPeriod:        l.positiveInt("SLOW_LIST_MAX_PERIOD", 4),
+		NamespaceHourlyBudget:    l.nonNegativeInt("NAMESPACE_HOURLY_BUDGET", 0),
+		BudgetStateConfigMap:     l.string("BUDGET_STATE_CONFIGMAP", ""),
+		BudgetStateFile:          l.string("BUDGET_STATE_FILE", ""),
+		BudgetFlushInterval:      l.duration("BUDGET_FLUSH_INTERVAL", 30*time.Second),
+		DeleteRatePerSec:         l.float("DELETE_RATE_PER_SEC", 0),
+		DeleteRetryBaseDelay:     l.duration("DELETE_RETRY_BASE_DELAY", 500*time.Millisecond),
+		DeleteRetryMaxDelay:      l.duration("DELETE_RETRY_MAX_DELAY", 30*time.Second),
+		VerifyDeletion:           l.bool("VERIFY_DELETION", false),
+		VerifyDeletionTimeout:    l.duration("VERIFY_DELETION_TIMEOUT", 10*time.Second),
+		KillSwitchConfigMap:      l.string("KILL_SWITCH_CONFIGMAP", ""),
+		SkipDuringUpgrade:        l.float("SKIP_DURING_UPGRADE", 0),
+		TriggerToken:             l.secret("TRIGGER_TOKEN"),
+		LabelSelector:            selector,
+		PodLabelSelector:         l.selector("POD_LABEL_SELECTOR", selector),
+		JobLabelSelector:         l.selector("JOB_LABEL_SELECTOR", selector),
+		PodMinAge:                l.duration("POD_MIN_AGE", 0),
+		NodeName:                 l.string("NODE_NAME", ""),
+		PodName:                  l.string("POD_NAME", ""),
+		PodNamespace:             l.string("POD_NAMESPACE", ""),
+		DaemonSetMode:            l.bool("DAEMONSET_MODE", false),
+		ContainerStatuses:        l.list("CONTAINER_STATUSES", ""),
+		StatusMatchMode:          l.string("STATUS_MATCH_MODE", "exact"),
+		ContainerMessageContains: l.list("CONTAINER_MESSAGE_CONTAINS", ""),
+		PodConditions:            l.podConditions("POD_CONDITIONS"),
+		UseLastTermination:       l.bool("USE_LAST_TERMINATION", false),
+		ContainerGranularity:     l.string("CONTAINER_GRANULARITY", "pod"),
+		StatusMatchAll:           l.bool("STATUS_MATCH_ALL", false),
+		PodTTLAfterFinished:      l.ttl("POD_TTL_AFTER_FINISHED", ttls, "finished_pods", 0),
+		LastTerminationTTL:       l.ttl("LAST_TERMINATION_TTL", ttls, "last_termination", 0),
+		CrashLoopMinDuration:     l.ttl("CRASHLOOP_MIN_DURATION", ttls, "crashloop", 0),
+		ImagePullMinAge:          l.ttl("IMAGE_PULL_MIN_AGE", ttls, "image_pull", 0),
+		PendingTTL:               l.ttl("PENDING_TTL", ttls, "pending_pods", time.Hour),
+		PendingUnschedulableOnly: l.bool("PENDING_UNSCHEDULABLE_ONLY", false),
+		NotReadyTTL:              l.ttl("NOT_READY_TTL", ttls, "not_ready", time.Hour),
+		MaxRestartRate:           l.float("MAX_RESTART_RATE", 0),
+		SchedulerNameExclude:     l.list("SCHEDULER_NAME_EXCLUDE", ""),
+		SkipIfAnyRunning:         l.bool("SKIP_IF_ANY_RUNNING", false),
+		SkipPVCMounters:          l.bool("SKIP_PVC_MOUNTERS", false),
+		RespectMinReady:          l.bool("RESPECT_MIN_READY", false),
+		SkipServiceEndpoints:     l.bool("SKIP_SERVICE_ENDPOINTS", false),
+		OnlyOrphans:              l.bool("ONLY_ORPHANS", false),
+		SkipControlledPods:       l.bool("SKIP_CONTROLLED_PODS", false),
+		ProtectedOwnerKinds:      l.list("PROTECTED_OWNER_KINDS", ""),
+		DeleteImageAllowlist:     l.regexps("DELETE_IMAGE_ALLOWLIST"),
+		DeleteImageDenylist:      l.regexps("DELETE_IMAGE_DENYLIST"),
+		ProtectAnnotation:        l.string("PROTECT_ANNOTATION", "pod-pruner.saidsef.co.uk/protect"),
+		SelectionAnnotation:      l.string("SELECTION_ANNOTATION", ""),
+		FinalizerAllowlist:       l.list("FINALIZER_ALLOWLIST", ""),
+		JobStatuses:              l.jobStatuses("JOB_STATUSES", "Complete"),
+		JobTTL:                   l.ttl("JOB_TTL", ttls, "jobs", 0),
+		JobMaxAge:                l.ttl("JOB_MAX_AGE", ttls, "job_max_age", 0),
+		JobInformer:              l.bool("JOB_INFORMER", false),
+		ConfigMapTTL:             l.ttl("CONFIGMAP_TTL", ttls, "configmaps", 24*time.Hour),
+		ResourceTTLs:             ttls,
+		Port:                     l.string("PORT", "8080"),
+		MetricsAuthToken:         l.secret("METRICS_AUTH_TOKEN"),
+		MetricsRequired:          l.bool("METRICS_REQUIRED", false),
+		MetricsNamespace:         l.string("METRICS_NAMESPACE", "pod_pruner"),
+		MetricsLegacyNames:       l.bool("METRICS_LEGACY_NAMES", false),
+		MetricsStateLabels:       l.list("METRICS_STATE_LABELS", strings.Join(defaultStateLabels, ",")),
+		HeartbeatFile:            l.string("HEARTBEAT_FILE", ""),
+		PushgatewayURL:           l.string("PUSHGATEWAY_URL", ""),
+		PushgatewayJob:           l.string("PUSHGATEWAY_JOB", "pod-pruner"),
+		StatusCR:                 l.string("STATUS_CR", ""),
+		PlanOutput:               l.string("PLAN_OUTPUT", ""),
+		PlanInput:                l.string("PLAN_INPUT", ""),
+		BaselinePlan:             l.string("BASELINE_PLAN", ""),
+		AuditSinkAddr:            l.string("AUDIT_SINK_ADDR", ""),
+		LogResourceTemplate:      l.template("LOG_RESOURCE_TEMPLATE"),
+		NotifyWebhookURL:         l.secret("NOTIFY_WEBHOOK_URL"),
+		NotifyTimeout:            l.duration("NOTIFY_TIMEOUT", 5*time.Second),
+		NotifyMaxItems:           l.positiveInt("NOTIFY_MAX_ITEMS", 50),
+		SMTPHost:                 l.string("SMTP_HOST", ""),
+		SMTPPort:                 l.string("SMTP_PORT", "587"),
+		SMTPFrom:                 l.string("SMTP_FROM", ""),
+		SMTPTo:                   l.list("SMTP_TO", ""),
+		SMTPUsername:             l.string("SMTP_USERNAME", ""),
+		SMTPPassword:             l.secret("SMTP_PASSWORD"),
+		SMTPTLS:                  l.string("SMTP_TLS", "starttls"),
+	}
+	cfg.settings = l.settings
+	cfg.ContainerStatuses, cfg.StatusPatterns = l.statusPatterns(cfg.ContainerStatuses, cfg.StatusMatchMode)
+
+	if utils.Contains(cfg.Resources, "PODS") && len(cfg.ContainerStatuses) == 0 && len(cfg.StatusPatterns) == 0 && cfg.PodTTLAfterFinished == 0 && cfg.CrashLoopMinDuration == 0 && cfg.ImagePullMinAge == 0 && cfg.MaxRestartRate == 0 && len(cfg.PodConditions) == 0 {
+		l.errs = append(l.errs, fmt.Errorf("CONTAINER_STATUSES environment variable is not set or empty"))
+	}
+	if utils.Contains(cfg.Resources, "PENDING_PODS") && cfg.PendingTTL == 0 {
+		l.errs = append(l.errs, fmt.Errorf("PENDING_TTL must be greater than 0 when PENDING_PODS is set"))
+	}
+	if utils.Contains(cfg.Resources, "NOTREADY_PODS") && cfg.NotReadyTTL == 0 {
+		l.errs = append(l.errs, fmt.Errorf("NOT_READY_TTL must be greater than 0 when NOTREADY_PODS is set"))
+	}
+	if cfg.SMTPHost != "" {
+		if cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+			l.errs = append(l.errs, fmt.Errorf("SMTP_FROM and SMTP_TO must be set when SMTP_HOST is set"))
+		}
+		if !utils.Contains([]string{"starttls", "tls", "none"}, cfg.SMTPTLS) {
+			l.errs = append(l.errs, fmt.Errorf("SMTP_TLS must be starttls, tls or none, got '%s'", cfg.SMTPTLS))
+		}
+	}
+	if namespace, name, found := strings.Cut(cfg.KillSwitchConfigMap, "/"); cfg.KillSwitchConfigMap != "" && (!found || namespace == "" || name == "") {
+		l.errs = append(l.errs, fmt.Errorf("KILL_SWITCH_CONFIGMAP must be in the format namespace/name, got '%s'", cfg.KillSwitchConfigMap))
+	}
+	if namespace, name, found := strings.Cut(cfg.BudgetStateConfigMap, "/"); cfg.BudgetStateConfigMap != "" && (!found || namespace == "" || name == "") {
+		l.errs = append(l.errs, fmt.Errorf("BUDGET_STATE_CONFIGMAP must be in the format namespace/name, got '%s'", cfg.BudgetStateConfigMap))
+	}
+	if cfg.BudgetStateConfigMap != "" || cfg.BudgetStateFile != "" {
+		if cfg.BudgetStateConfigMap != "" && cfg.BudgetStateFile != "" {
+			l.errs = append(l.errs, fmt.Errorf("BUDGET_STATE_CONFIGMAP and BUDGET_STATE_FILE cannot be set at the same time"))
+		}
+		if cfg.NamespaceHourlyBudget == 0 {
+			l.errs = append(l.errs, fmt.Errorf("NAMESPACE_HOURLY_BUDGET must be set to persist the deletion budget"))
+		}
+		if cfg.BudgetFlushInterval <= 0 {
+			l.errs = append(l.errs, fmt.Errorf("BUDGET_FLUSH_INTERVAL must be greater than 0 when the deletion budget is persisted"))
+		}
+	}
+	if cfg.SkipDuringUpgrade > 1 {
+		l.errs = append(l.errs, fmt.Errorf("SKIP_DURING_UPGRADE must be a fraction between 0 and 1, got '%g'", cfg.SkipDuringUpgrade))
+	}
+	if !utils.Contains([]string{"pod", "container"}, cfg.ContainerGranularity) {
+		l.errs = append(l.errs, fmt.Errorf("CONTAINER_GRANULARITY must be pod or container, got '%s'", cfg.ContainerGranularity))
+	}
+	if cfg.PlanOutput != "" && cfg.PlanOutput != "yaml" {
+		l.errs = append(l.errs, fmt.Errorf("PLAN_OUTPUT must be yaml or unset, got '%s'", cfg.PlanOutput))
+	}
+	l.deletionOrder("DELETION_ORDER", cfg.DeletionOrder)
+	if cfg.DaemonSetMode {
+		if cfg.NodeName == "" {
+			l.errs = append(l.errs, fmt.Errorf("NODE_NAME must be set, typically from the downward API, when DAEMONSET_MODE is enabled"))
+		}
+		for _, resource := range cfg.Resources {
+			if !utils.Contains(NodeLocalResources, resource) {
+				l.errs = append(l.errs, fmt.Errorf("RESOURCES may only contain %s when DAEMONSET_MODE is enabled, got '%s'", strings.Join(NodeLocalResources, ", "), resource))
+			}
+		}
+		if cfg.JobInformer || cfg.StatusCR != "" {
+			l.errs = append(l.errs, fmt.Errorf("JOB_INFORMER and STATUS_CR cannot be used when DAEMONSET_MODE is enabled"))
+		}
+	}
+	if cfg.PlanOutput != "" && cfg.PlanInput != "" {
+		l.errs = append(l.errs, fmt.Errorf("PLAN_OUTPUT and PLAN_INPUT cannot be set at the same time"))
+	}
+	if cfg.BaselinePlan != "" && (cfg.PlanOutput != "" || cfg.PlanInput != "") {
+		l.errs = append(l.errs, fmt.Errorf("BASELINE_PLAN cannot be combined with PLAN_OUTPUT or PLAN_INPUT"))
+	}
+	if cfg.VerifyDeletion && cfg.VerifyDeletionTimeout == 0 {
+		l.errs = append(l.errs, fmt.Errorf("VERIFY_DELETION_TIMEOUT must be greater than 0 when VERIFY_DELETION is enabled"))
+	}
+	if cfg.PushgatewayURL != "" && cfg.PushgatewayJob == "" {
+		l.errs = append(l.errs, fmt.Errorf("PUSHGATEWAY_JOB must not be empty when PUSHGATEWAY_URL is set"))
+	}
+	if (cfg.PodName == "") != (cfg.PodNamespace == "") {
+		l.errs = append(l.errs, fmt.Errorf("POD_NAME and POD_NAMESPACE must be set together"))
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		l.errs = append(l.errs, fmt.Errorf("PORT must be a port number between 1 and 65535, got '%s'", cfg.Port))
+	}
+	if cfg.MetricsNamespace != "" && !metricNamespacePattern.MatchString(cfg.MetricsNamespace) {
+		l.errs = append(l.errs, fmt.Errorf("METRICS_NAMESPACE must only contain letters, digits and underscores and not start with a digit, got '%s'", cfg.MetricsNamespace))
+	}
+	if cfg.DeleteRetryMaxDelay < cfg.DeleteRetryBaseDelay {
+		l.errs = append(l.errs, fmt.Errorf("DELETE_RETRY_MAX_DELAY must not be less than DELETE_RETRY_BASE_DELAY"))
+	}
+
+	return cfg, errors.Join(l.errs...)
+}
+
+// Settings returns every resolved setting in the order it was loaded.
+func (c Config) Settings() []Setting {
+	return c.settings
+}
+
+// Fields renders the resolved settings as "KEY:value (source)" entries suitable
+// for utils.LogWithFields, giving a one-glance view of the effective configuration.
+func (c Config) Fields() []string {
+	fields := make([]string, 0, len(c.settings))
+	for _, setting := range c.settings {
+		fields = append(fields, fmt.Sprintf("%s:%s (%s)", setting.Key, setting.Value, setting.Source))
+	}
+	return fields
+}
+
+// loader reads environment variables, recording the source of each value and
+// collecting validation errors instead of failing on the first one.
+type loader struct {
+	settings []Setting
+	errs     []error
+}
+
+// lookup returns the raw value for key and records where it came from.
+func (l *loader) lookup(key, defaultValue string, redact bool) (string, bool) {
+	value, exists := os.LookupEnv(key)
+	source := "env"
+	if !exists {
+		value, source = defaultValue, "default"
+	}
+
+	display := value
+	if redact && value != "" {
+		display = "<redacted>"
+	}
+	l.settings = append(l.settings, Setting{Key: key, Value: display, Source: source})
+	return value, exists
+}
+
+// string resolves a plain string setting.
+func (l *loader) string(key, defaultValue string) string {
+	value, _ := l.lookup(key, defaultValue, false)
+	return value
+}
+
+// secret resolves a string setting whose value must never be logged.
+func (l *loader) secret(key string) string {
+	value, _ := l.lookup(key, "", true)
+	return value
+}
+
+// bool resolves a "true"/"false" setting.
+func (l *loader) bool(key string, defaultValue bool) bool {
+	value, _ := l.lookup(key, strconv.FormatBool(defaultValue), false)
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be true or false, got '%s'", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// positiveInt resolves an integer setting that must be at least 1.
+func (l *loader) positiveInt(key string, defaultValue int) int {
+	value, _ := l.lookup(key, strconv.Itoa(defaultValue), false)
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a positive integer, got '%s'", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// nonNegativeInt resolves an integer setting that must be 0 or greater.
+func (l *loader) nonNegativeInt(key string, defaultValue int) int {
+	value, _ := l.lookup(key, strconv.Itoa(defaultValue), false)
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative integer, got '%s'", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// float resolves a non-negative floating point setting.
+func (l *loader) float(key string, defaultValue float64) float64 {
+	value, _ := l.lookup(key, strconv.FormatFloat(defaultValue, 'f', -1, 64), false)
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative number, got '%s'", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// duration resolves a non-negative time.Duration setting (e.g., "30m").
+func (l *loader) duration(key string, defaultValue time.Duration) time.Duration {
+	value, _ := l.lookup(key, defaultValue.String(), false)
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative duration, got '%s'", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// ttl resolves a duration setting that a RESOURCE_TTLS entry may set instead. Setting
+// both is rejected, since it is not obvious which one should win.
+func (l *loader) ttl(key string, ttls map[string]time.Duration, name string, defaultValue time.Duration) time.Duration {
+	ttl, inMap := ttls[name]
+	if !inMap {
+		return l.duration(key, defaultValue)
+	}
+	if _, exists := os.LookupEnv(key); exists {
+		l.errs = append(l.errs, fmt.Errorf("%s and the RESOURCE_TTLS entry '%s' cannot be set at the same time", key, name))
+	}
+	parsed := l.duration(key, ttl)
+	l.settings[len(l.settings)-1].Source = "RESOURCE_TTLS"
+	return parsed
+}
+
+// durationMap resolves a comma-separated list of "name=duration" entries (e.g.,
+// "jobs=1h,pending_pods=30m"), rejecting names missing from known.
+func (l *loader) durationMap(key string, known map[string]string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, entry := range l.list(key, "") {
+		name, value, _ := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if _, ok := known[name]; !ok {
+			names := make([]string, 0, len(known))
+			for name := range known {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			l.errs = append(l.errs, fmt.Errorf("%s keys must be one of %s, got '%s'", key, strings.Join(names, ", "), entry))
+			continue
+		}
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || parsed < 0 {
+			l.errs = append(l.errs, fmt.Errorf("%s entry '%s' must be a non-negative duration, got '%s'", key, name, value))
+			continue
+		}
+		if _, duplicate := durations[name]; duplicate {
+			l.errs = append(l.errs, fmt.Errorf("%s contains '%s' more than once", key, name))
+		}
+		durations[name] = parsed
+	}
+	return durations
+}
+
+// list resolves a comma-separated setting, trimming whitespace and dropping empty entries.
+func (l *loader) list(key, defaultValue string) []string {
+	value, _ := l.lookup(key, defaultValue, false)
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// selector resolves a Kubernetes label selector (e.g., "app=batch,tier!=db"), or fallback when unset.
+func (l *loader) selector(key string, fallback labels.Selector) labels.Selector {
+	value := l.string(key, "")
+	if value == "" {
+		return fallback
+	}
+	selector, err := labels.Parse(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a valid label selector, got '%s': %w", key, value, err))
+		return nil
+	}
+	return selector
+}
+
+// regexps resolves a comma-separated list of regular expressions, compiling each once.
+func (l *loader) regexps(key string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range l.list(key, "") {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s contains an invalid regular expression '%s': %w", key, pattern, err))
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// template resolves a Go text/template, parsing it once. It returns nil when unset.
+func (l *loader) template(key string) *template.Template {
+	value := l.string(key, "")
+	if value == "" {
+		return nil
+	}
+	tmpl, err := template.New(key).Parse(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a valid Go template, got '%s': %w", key, value, err))
+		return nil
+	}
+	return tmpl
+}
+
+// namespaceOverrides resolves a YAML or JSON file mapping namespace names to their
+// NamespaceOverride, validating every entry. It returns nil when unset.
+func (l *loader) namespaceOverrides(key string) NamespaceOverrides {
+	path := l.string(key, "")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s could not be read: %w", key, err))
+		return nil
+	}
+	var overrides NamespaceOverrides
+	if err := yaml.UnmarshalStrict(data, &overrides); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must map namespaces to deleteConcurrency and deletionOrder: %w", key, err))
+		return nil
+	}
+	namespaces := make([]string, 0, len(overrides))
+	for namespace := range overrides {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		override := overrides[namespace]
+		if override.DeleteConcurrency < 0 {
+			l.errs = append(l.errs, fmt.Errorf("%s deleteConcurrency of namespace '%s' must be a non-negative integer, got '%d'", key, namespace, override.DeleteConcurrency))
+		}
+		l.deletionOrder(fmt.Sprintf("%s deletionOrder of namespace '%s'", key, namespace), override.DeletionOrder)
+	}
+	return overrides
+}
+
+// deletionOrder validates a list of resource types in the DELETION_ORDER format.
+func (l *loader) deletionOrder(name string, order []string) {
+	for i, resource := range order {
+		if !utils.Contains(ResourceTypes, resource) || utils.Contains(order[:i], resource) {
+			l.errs = append(l.errs, fmt.Errorf("%s entries must be distinct and one of %s, got '%s'", name, strings.Join(ResourceTypes, ", "), resource))
+		}
+	}
+}
+
+// jobStatuses resolves a comma-separated list of job condition types, each one of
+// JobConditionTypes.
+func (l *loader) jobStatuses(key, defaultValue string) []string {
+	var statuses []string
+	for _, status := range l.list(key, defaultValue) {
+		if !utils.Contains(JobConditionTypes, status) {
+			l.errs = append(l.errs, fmt.Errorf("%s entries must be one of %s, got '%s'", key, strings.Join(JobConditionTypes, ", "), status))
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// podConditions resolves a comma-separated list of pod conditions in the format
+// "Type=Status[:Reason]" (e.g., "PodScheduled=False:Unschedulable").
+func (l *loader) podConditions(key string) []PodCondition {
+	var conditions []PodCondition
+	for _, entry := range l.list(key, "") {
+		conditionType, rest, _ := strings.Cut(entry, "=")
+		status, reason, _ := strings.Cut(rest, ":")
+		if conditionType == "" || !utils.Contains([]string{"True", "False", "Unknown"}, status) {
+			l.errs = append(l.errs, fmt.Errorf("%s entries must be in the format Type=True|False|Unknown[:Reason], got '%s'", key, entry))
+			continue
+		}
+		conditions = append(conditions, PodCondition{Type: conditionType, Status: status, Reason: reason})
+	}
+	return conditions
+}
+
+// statusPatterns splits CONTAINER_STATUSES into plain reasons and compiled regular
+// expressions. Entries with a leading "~" are always treated as patterns, and every
+// entry is when mode is "regex".
+func (l *loader) statusPatterns(statuses []string, mode string) ([]string, []*regexp.Regexp) {
+	if mode != "exact" && mode != "regex" {
+		l.errs = append(l.errs, fmt.Errorf("STATUS_MATCH_MODE must be exact or regex, got '%s'", mode))
+	}
+
+	var exact []string
+	var compiled []*regexp.Regexp
+	for _, status := range statuses {
+		pattern, isPattern := strings.CutPrefix(status, "~")
+		if !isPattern && mode != "regex" {
+			exact = append(exact, status)
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("CONTAINER_STATUSES contains an invalid regular expression '%s': %w", pattern, err))
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return exact, compiled
+}
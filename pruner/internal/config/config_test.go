@@ -0,0 +1,145 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatusPatterns(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []string
+		mode         string
+		wantExact    []string
+		wantPatterns []string
+		wantErr      bool
+	}{
+		{
+			name:      "exact mode keeps plain reasons",
+			statuses:  []string{"CrashLoopBackOff", "Error"},
+			mode:      "exact",
+			wantExact: []string{"CrashLoopBackOff", "Error"},
+		},
+		{
+			name:         "leading tilde marks a pattern in exact mode",
+			statuses:     []string{"Error", "~^CNI.*$"},
+			mode:         "exact",
+			wantExact:    []string{"Error"},
+			wantPatterns: []string{"^CNI.*$"},
+		},
+		{
+			name:         "regex mode compiles every entry",
+			statuses:     []string{"Error", "~Exit[0-9]+"},
+			mode:         "regex",
+			wantPatterns: []string{"Error", "Exit[0-9]+"},
+		},
+		{
+			name:     "invalid pattern is rejected",
+			statuses: []string{"~("},
+			mode:     "exact",
+			wantErr:  true,
+		},
+		{
+			name:      "unknown mode is rejected",
+			statuses:  []string{"Error"},
+			mode:      "glob",
+			wantExact: []string{"Error"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loader{}
+			exact, patterns := l.statusPatterns(tt.statuses, tt.mode)
+			var got []string
+			for _, pattern := range patterns {
+				got = append(got, pattern.String())
+			}
+			if !reflect.DeepEqual(exact, tt.wantExact) || !reflect.DeepEqual(got, tt.wantPatterns) {
+				t.Errorf("statusPatterns() = %q, %q, want %q, %q", exact, got, tt.wantExact, tt.wantPatterns)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("statusPatterns() errors = %v, want error %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPodConditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []PodCondition
+		wantErr bool
+	}{
+		{
+			name:  "type, status and reason",
+			value: "PodScheduled=False:Unschedulable",
+			want:  []PodCondition{{Type: "PodScheduled", Status: "False", Reason: "Unschedulable"}},
+		},
+		{
+			name:  "several conditions without reason",
+			value: "Ready=False, ContainersReady=Unknown",
+			want:  []PodCondition{{Type: "Ready", Status: "False"}, {Type: "ContainersReady", Status: "Unknown"}},
+		},
+		{name: "invalid status", value: "PodScheduled=No", wantErr: true},
+		{name: "missing type", value: "=False", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_CONDITIONS", tt.value)
+			l := &loader{}
+			if got := l.podConditions("POD_CONDITIONS"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podConditions() = %v, want %v", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("podConditions() errors = %v, want error %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJobStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "terminal conditions", value: "Complete, Failed", want: []string{"Complete", "Failed"}},
+		{name: "conditions set before terminal ones", value: "FailureTarget,SuccessCriteriaMet", want: []string{"FailureTarget", "SuccessCriteriaMet"}},
+		{name: "suspended jobs are not finished", value: "Complete,Suspended", want: []string{"Complete"}, wantErr: true},
+		{name: "unknown condition", value: "Done", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JOB_STATUSES", tt.value)
+			l := &loader{}
+			if got := l.jobStatuses("JOB_STATUSES", "Complete"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jobStatuses() = %v, want %v", got, tt.want)
+			}
+			if (len(l.errs) > 0) != tt.wantErr {
+				t.Errorf("jobStatuses() errors = %v, want error %v", l.errs, tt.wantErr)
+			}
+		})
+	}
+}
@@ -17,16 +17,37 @@ limitations under the License.
 package metrics
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
 	"github.com/saidsef/pod-pruner/pruner/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultMetricsNamespace is the prefix metrics are registered under until
+// StartMetricsServer applies METRICS_NAMESPACE and METRICS_LEGACY_NAMES.
+const defaultMetricsNamespace = "pod_pruner"
+
+// metricsNamespace is the prefix every metric is currently registered under.
+var metricsNamespace = defaultMetricsNamespace
+
+// otherState is the state label value used for reasons outside the allowlist.
+const otherState = "other"
+
+// stateLabels is the set of reasons kept as state label values, so arbitrary
+// reason strings cannot blow up the cardinality of the pruned counters. It is set
+// from METRICS_STATE_LABELS by SetStateLabels.
+var stateLabels atomic.Pointer[map[string]struct{}]
+
 // Define counters for metrics
 var (
 	// PodsPruned counts the total number of pods pruned, labelled by namespace.
@@ -47,6 +68,16 @@ var (
 		[]string{"namespace", "state"},
 	)
 
+	// ContainersObserved counts the matching containers that were not pruned because other
+	// containers of their pod are healthy, with CONTAINER_GRANULARITY set to "container".
+	ContainersObserved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "containers_observed_total",
+			Help: "Total number of matching containers observed but not pruned",
+		},
+		[]string{"namespace", "state"},
+	)
+
 	// JobsPruned counts the total number of jobs pruned, labelled by namespace.
 	JobsPruned = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -56,27 +87,399 @@ var (
 		[]string{"namespace", "state"},
 	)
 
+	// ConfigMapsPruned counts the total number of unreferenced ConfigMaps pruned, labelled by namespace.
+	ConfigMapsPruned = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "configmaps_pruned_total",
+			Help: "Total number of configmaps pruned",
+		},
+		[]string{"namespace", "state"},
+	)
+
+	// DeletionsUnconfirmed counts deletions that were not confirmed within VERIFY_DELETION_TIMEOUT,
+	// labelled by namespace and kind. They are not counted as pruned.
+	DeletionsUnconfirmed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "deletions_unconfirmed_total",
+			Help: "Total number of deletions not confirmed within the verify timeout",
+		},
+		[]string{"namespace", "kind"},
+	)
+
+	// PodsScanned counts the total number of pods listed while looking for containers to prune, labelled by namespace.
+	PodsScanned = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pods_scanned_total",
+			Help: "Total number of pods scanned",
+		},
+		[]string{"namespace"},
+	)
+
+	// ReclaimableCPU reports the CPU cores requested by the pods selected for pruning in the
+	// most recent cycle, labelled by namespace.
+	ReclaimableCPU = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "reclaimable_cpu_cores",
+			Help: "CPU cores requested by pods selected for pruning in the last cycle",
+		},
+		[]string{"namespace"},
+	)
+
+	// ReclaimableMemory reports the memory bytes requested by the pods selected for pruning
+	// in the most recent cycle, labelled by namespace.
+	ReclaimableMemory = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "reclaimable_memory_bytes",
+			Help: "Memory bytes requested by pods selected for pruning in the last cycle",
+		},
+		[]string{"namespace"},
+	)
+
+	// DeletionBudgetRemaining reports the deletions left in the NAMESPACE_HOURLY_BUDGET of
+	// each namespace over the last hour, labelled by namespace.
+	DeletionBudgetRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "deletion_budget_remaining",
+			Help: "Deletions left in the hourly budget of the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// Up is set to 1 once the pruner has started, so a running but idle pruner can be
+	// told apart from one that is down. It keeps the pod_pruner prefix with
+	// METRICS_LEGACY_NAMES, since a bare "up" would clash with the scrape health metric.
+	Up = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "up",
+			Help: "Whether the pruner is running",
+		},
+	)
+
+	// NamespaceScanPeriod reports the number of cycles between two scans of each namespace
+	// with SLOW_LIST_THRESHOLD, labelled by namespace. It is 1 for namespaces scanned every cycle.
+	NamespaceScanPeriod = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "namespace_scan_period_cycles",
+			Help: "Number of cycles between two scans of the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// ClusterCandidates reports the total number of resources selected for pruning
+	// across all namespaces during the most recent reconcile cycle.
+	ClusterCandidates = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cluster_prune_candidates",
+			Help: "Total number of prune candidates across all namespaces in the last cycle",
+		},
+	)
+
+	// ClusterPruned reports the total number of resources deleted across all
+	// namespaces during the most recent reconcile cycle.
+	ClusterPruned = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cluster_pruned_resources",
+			Help: "Total number of resources pruned across all namespaces in the last cycle",
+		},
+	)
+
+	// ConsecutiveFailures reports the number of reconcile cycles in a row that failed
+	// as a whole, reset to 0 by the next successful cycle.
+	ConsecutiveFailures = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "consecutive_failures",
+			Help: "Number of consecutive failed reconcile cycles",
+		},
+	)
+
+	// ReconcileSkipped counts reconcile cycles that were deliberately skipped, labelled
+	// by reason: SkipShutdown, SkipPaused or SkipOverlap.
+	ReconcileSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "reconcile_skipped_total",
+			Help: "Total number of reconcile cycles skipped",
+		},
+		[]string{"reason"},
+	)
+
 	once sync.Once
 )
 
-// init registers the defined metrics with Prometheus.
+// The reasons a reconcile cycle is skipped, used as ReconcileSkipped label values and
+// returned by the RegisterReconcileTrigger trigger.
+const (
+	SkipShutdown = "shutdown" // SkipShutdown is reported once the pruner is shutting down.
+	SkipPaused   = "paused"   // SkipPaused is reported while the pruner is paused.
+	SkipOverlap  = "overlap"  // SkipOverlap is reported while another cycle is still running.
+)
+
+// pushTimeout bounds a single push to the Pushgateway.
+const pushTimeout = 10 * time.Second
+
+// metricsRetryInterval is how long to wait before binding the metrics port again
+// after the server failed, unless METRICS_REQUIRED is "true".
+const metricsRetryInterval = 30 * time.Second
+
+// resolveMetricsNamespace returns the metric name prefix based on METRICS_NAMESPACE
+// and METRICS_LEGACY_NAMES, which drops the prefix so existing dashboards keep
+// working during the transition.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - The metric name prefix, empty for none.
+func resolveMetricsNamespace(cfg config.Config) string {
+	if cfg.MetricsLegacyNames {
+		return ""
+	}
+	return cfg.MetricsNamespace
+}
+
+// upNamespace returns the prefix of the Up metric: the metrics namespace, or
+// "pod_pruner" when it is empty.
+//
+// Parameters:
+// - namespace: The prefix of every other metric.
+//
+// Returns:
+// - The prefix of the Up metric.
+func upNamespace(namespace string) string {
+	if namespace == "" {
+		return defaultMetricsNamespace
+	}
+	return namespace
+}
+
+// prefixed returns a registerer adding the namespace and an underscore in front of
+// every metric name, as the Namespace field of the metric options would.
+//
+// Parameters:
+// - namespace: The metric name prefix, empty for none.
+//
+// Returns:
+// - A registerer wrapping the default one.
+func prefixed(namespace string) prometheus.Registerer {
+	if namespace == "" {
+		return prometheus.DefaultRegisterer
+	}
+	return prometheus.WrapRegistererWithPrefix(namespace+"_", prometheus.DefaultRegisterer)
+}
+
+// collectors returns every defined metric except Up, which is prefixed separately.
+func collectors() []prometheus.Collector {
+	return []prometheus.Collector{PodsPruned, ContainersPruned, ContainersObserved, JobsPruned, ConfigMapsPruned, DeletionsUnconfirmed, PodsScanned, ReclaimableCPU, ReclaimableMemory, DeletionBudgetRemaining, NamespaceScanPeriod, ClusterCandidates, ClusterPruned, ConsecutiveFailures, ReconcileSkipped}
+}
+
+// register registers every defined metric under the given prefix.
+//
+// Parameters:
+// - namespace: The metric name prefix, empty for none.
+func register(namespace string) {
+	prefixed(namespace).MustRegister(collectors()...)
+	prefixed(upNamespace(namespace)).MustRegister(Up)
+}
+
+// setMetricsNamespace re-registers every defined metric under the given prefix, so the
+// names follow the configuration whatever was registered at init time.
+//
+// Parameters:
+// - namespace: The metric name prefix, empty for none.
+func setMetricsNamespace(namespace string) {
+	if namespace == metricsNamespace {
+		return
+	}
+	for _, collector := range collectors() {
+		prefixed(metricsNamespace).Unregister(collector)
+	}
+	prefixed(upNamespace(metricsNamespace)).Unregister(Up)
+	register(namespace)
+	metricsNamespace = namespace
+}
+
+// resolveStateLabels returns the allowed state label values as a set.
+//
+// Parameters:
+// - values: The reasons listed in METRICS_STATE_LABELS.
+//
+// Returns:
+// - The set of reasons kept as state label values.
+func resolveStateLabels(values []string) map[string]struct{} {
+	labels := make(map[string]struct{}, len(values))
+	for _, label := range values {
+		labels[label] = struct{}{}
+	}
+	return labels
+}
+
+// SetStateLabels replaces the reasons kept as state label values. It is called by
+// StartMetricsServer and by every reconcile cycle, so library callers that never
+// start the metrics server record the configured states too.
+//
+// Parameters:
+// - values: The reasons listed in METRICS_STATE_LABELS.
+func SetStateLabels(values []string) {
+	labels := resolveStateLabels(values)
+	stateLabels.Store(&labels)
+}
+
+// StateLabel maps a reason to the state label value recorded for it.
+//
+// Parameters:
+// - state: The reason a resource was pruned for (e.g., CrashLoopBackOff).
+//
+// Returns:
+// - The reason itself when it is allowed, "other" otherwise.
+func StateLabel(state string) string {
+	if labels := stateLabels.Load(); labels != nil {
+		if _, allowed := (*labels)[state]; allowed {
+			return state
+		}
+	}
+	return otherState
+}
+
+// ForgetNamespace deletes the series of every namespace-labelled gauge for the given
+// namespace. Counters are kept, since their totals remain meaningful.
+//
+// Parameters:
+// - namespace: The namespace that is no longer pruned.
+func ForgetNamespace(namespace string) {
+	ReclaimableCPU.DeleteLabelValues(namespace)
+	ReclaimableMemory.DeleteLabelValues(namespace)
+	DeletionBudgetRemaining.DeleteLabelValues(namespace)
+	NamespaceScanPeriod.DeleteLabelValues(namespace)
+}
+
+// init registers the defined metrics with Prometheus under defaultMetricsNamespace. It
+// has no other side effects; the metrics server is started, and the configured prefix
+// applied, by StartMetricsServer once the configuration is resolved.
 func init() {
 	once.Do(func() {
-		logger := utils.Logger()
-		utils.LogWithFields(logrus.InfoLevel, []string{}, "registering prometheus metrics count vectors")
-		prometheus.MustRegister(PodsPruned, ContainersPruned, JobsPruned)
-		StartMetricsServer(logger)
+		register(defaultMetricsNamespace)
 	})
 }
 
-// StartMetricsServer starts the metrics server and adds a handler for the /metrics endpoint.
-func StartMetricsServer(log *logrus.Logger) {
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		port := utils.GetEnv("PORT", "8080", log)
+// Push pushes the current value of every registered metric to a Prometheus
+// Pushgateway, replacing the metrics previously pushed for the job, so short-lived
+// runs report their counts before the process exits.
+//
+// Parameters:
+// - url: The Pushgateway URL (e.g., http://pushgateway:9091).
+// - job: The job label the metrics are grouped under.
+//
+// Returns:
+// - An error if the metrics could not be pushed.
+func Push(url, job string) error {
+	return push.New(url, job).
+		Client(&http.Client{Timeout: pushTimeout}).
+		Gatherer(prometheus.DefaultGatherer).
+		Push()
+}
+
+// StartMetricsServer applies the metric name prefix and state labels, then starts the metrics server on
+// PORT and adds a handler for the /metrics endpoint.
+// When METRICS_AUTH_TOKEN is set, scrapes must send it as a bearer token.
+// Metrics are not required for pruning, so a failing server is logged and retried
+// every metricsRetryInterval, unless METRICS_REQUIRED is enabled, in which case
+// the pruner exits.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+func StartMetricsServer(cfg config.Config) {
+	setMetricsNamespace(resolveMetricsNamespace(cfg))
+	SetStateLabels(cfg.MetricsStateLabels)
+
+	var handler http.Handler = promhttp.Handler()
+	if cfg.MetricsAuthToken != "" {
+		handler = requireBearer(cfg.MetricsAuthToken, handler)
+	}
+	http.Handle("/metrics", handler)
+	port := cfg.Port
+	Up.Set(1)
 
-		if err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil); err != nil {
-			utils.LogWithFields(logrus.FatalLevel, []string{}, "Metrics server failed to start", err)
+	go func() {
+		for {
+			err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+			if cfg.MetricsRequired {
+				utils.LogWithFields(logrus.FatalLevel, []string{}, "Metrics server failed to start", err)
+			}
+			utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("port:%s", port), fmt.Sprintf("retry:%s", metricsRetryInterval)}, "Metrics server failed, pruning continues without metrics", err)
+			time.Sleep(metricsRetryInterval)
 		}
 	}()
 }
+
+// RegisterReconcileTrigger adds a POST /reconcile handler to the metrics server that
+// runs a reconcile cycle on demand. Requests must carry the given token as an
+// "Authorization: Bearer <token>" header.
+//
+// Parameters:
+// - token: The bearer token required to trigger a reconcile.
+// - trigger: A function that runs one reconcile cycle and returns a JSON-serialisable
+// summary, and the reason the cycle was skipped (e.g., SkipPaused), empty if it ran.
+func RegisterReconcileTrigger(token string, trigger func() (interface{}, string)) {
+	http.Handle("/reconcile", reconcileHandler(token, trigger))
+}
+
+// reconcileHandler serves POST /reconcile, see RegisterReconcileTrigger. A cycle
+// skipped because the pruner is shutting down is answered with 503, one skipped
+// because it is paused or another cycle is running with 409.
+//
+// Parameters:
+// - token: The bearer token required to trigger a reconcile.
+// - trigger: The function running one reconcile cycle.
+//
+// Returns:
+// - The handler.
+func reconcileHandler(token string, trigger func() (interface{}, string)) http.Handler {
+	return requireBearer(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		summary, skipped := trigger()
+		switch skipped {
+		case "":
+			// The cycle ran, respond with its summary.
+		case SkipShutdown:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		case SkipPaused:
+			http.Error(w, "reconcile paused", http.StatusConflict)
+			return
+		default:
+			http.Error(w, "reconcile already in progress", http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{}, "Failed to encode reconcile summary", err)
+		}
+	}))
+}
+
+// requireBearer wraps the handler so it only serves requests carrying the given token
+// as an "Authorization: Bearer <token>" header, and responds 401 otherwise. The token
+// is compared in constant time.
+//
+// Parameters:
+// - token: The bearer token required by the handler.
+// - next: The handler to protect.
+//
+// Returns:
+// - The wrapped handler.
+func requireBearer(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
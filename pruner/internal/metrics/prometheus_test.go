@@ -0,0 +1,89 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInitHasNoNetworkSideEffects(t *testing.T) {
+	if up := testutil.ToFloat64(Up); up != 0 {
+		t.Errorf("Up = %v before StartMetricsServer, want 0", up)
+	}
+	for _, path := range []string{"/metrics", "/reconcile"} {
+		if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, path, nil)); pattern != "" {
+			t.Errorf("%s is handled by %q before StartMetricsServer, want no handler", path, pattern)
+		}
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == defaultMetricsNamespace+"_up" {
+			return
+		}
+	}
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	t.Errorf("init did not register %s_up, got %s", defaultMetricsNamespace, strings.Join(names, ", "))
+}
+
+func TestStateLabel(t *testing.T) {
+	SetStateLabels([]string{"CrashLoopBackOff", "Error"})
+	for state, want := range map[string]string{"CrashLoopBackOff": "CrashLoopBackOff", "Error": "Error", "SomethingNew": otherState} {
+		if got := StateLabel(state); got != want {
+			t.Errorf("StateLabel(%q) = %q, want %q", state, got, want)
+		}
+	}
+}
+
+func TestReconcileHandler(t *testing.T) {
+	tests := []struct {
+		skipped    string
+		wantStatus int
+		wantBody   string
+	}{
+		{skipped: "", wantStatus: http.StatusOK, wantBody: `"ran"`},
+		{skipped: SkipOverlap, wantStatus: http.StatusConflict, wantBody: "already in progress"},
+		{skipped: SkipPaused, wantStatus: http.StatusConflict, wantBody: "paused"},
+		{skipped: SkipShutdown, wantStatus: http.StatusServiceUnavailable, wantBody: "shutting down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.skipped, func(t *testing.T) {
+			handler := reconcileHandler("secret", func() (interface{}, string) { return "ran", tt.skipped })
+			request := httptest.NewRequest(http.MethodPost, "/reconcile", nil)
+			request.Header.Set("Authorization", "Bearer secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("POST /reconcile = %d %q, want %d containing %q", recorder.Code, recorder.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
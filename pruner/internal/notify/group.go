@@ -0,0 +1,136 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+)
+
+// podTemplateHashAlphabet is the alphabet Kubernetes encodes pod-template-hash
+// values with, used to recognise ReplicaSets created by a Deployment.
+const podTemplateHashAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+// ownerGroup is the number of distinct resources of one kind selected under a
+// single controlling owner.
+type ownerGroup struct {
+	Owner     string `json:"owner"`     // Owner is the controlling owner as "Kind/Name", or "none".
+	Namespace string `json:"namespace"` // Namespace is the namespace of the owner and its resources.
+	Kind      string `json:"kind"`      // Kind is the kind of the grouped resources (e.g., pod, job).
+	Count     int    `json:"count"`     // Count is the number of distinct resources in the group.
+}
+
+// String returns the group in the format "Kind namespace/Name: N kinds".
+func (g ownerGroup) String() string {
+	noun := g.Kind + "s"
+	if g.Count == 1 {
+		noun = g.Kind
+	}
+	kind, name, found := strings.Cut(g.Owner, "/")
+	if !found {
+		return fmt.Sprintf("unowned in %s: %d %s", g.Namespace, g.Count, noun)
+	}
+	return fmt.Sprintf("%s %s/%s: %d %s", kind, g.Namespace, name, g.Count, noun)
+}
+
+// groupByOwner groups the candidates by the controlling owner captured when they
+// were selected. Pods of a Deployment are reported under the Deployment rather than
+// its ReplicaSet, and multiple entries for the same resource are counted once.
+// Groups are ordered by descending count, then by owner.
+//
+// Parameters:
+// - candidates: A slice of ContainerInfo to group.
+//
+// Returns:
+// - A slice of ownerGroup, one per owner and resource kind.
+func groupByOwner(candidates []resources.ContainerInfo) []ownerGroup {
+	seen := make(map[string]struct{}, len(candidates))
+	index := make(map[ownerGroup]int)
+	var groups []ownerGroup
+	for _, item := range candidates {
+		kind := item.Kind()
+		key := fmt.Sprintf("%s/%s/%s", kind, item.Namespace, item.PodName)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		group := ownerGroup{Owner: deploymentOwner(item), Namespace: item.Namespace, Kind: kind}
+		i, exists := index[group]
+		if !exists {
+			i = len(groups)
+			index[group] = i
+			groups = append(groups, group)
+		}
+		groups[i].Count++
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].String() < groups[j].String()
+	})
+	return groups
+}
+
+// deploymentOwner returns the owner of the resource, replacing a ReplicaSet named
+// after its Deployment and pod-template-hash with the Deployment itself.
+//
+// Parameters:
+// - item: The selected resource.
+//
+// Returns:
+// - The owner in the format "Kind/Name", or "none" if the resource has no owner.
+func deploymentOwner(item resources.ContainerInfo) string {
+	if item.OwnerKind != "ReplicaSet" {
+		return item.Owner()
+	}
+	i := strings.LastIndex(item.OwnerName, "-")
+	if i <= 0 {
+		return item.Owner()
+	}
+	hash := item.OwnerName[i+1:]
+	if len(hash) < 5 || len(hash) > 10 || strings.Trim(hash, podTemplateHashAlphabet) != "" {
+		return item.Owner()
+	}
+	return fmt.Sprintf("Deployment/%s", item.OwnerName[:i])
+}
+
+// describeGroups joins up to maxItems groups into a single line such as
+// "Deployment default/foo: 3 pods, CronJob default/bar: 5 jobs".
+//
+// Parameters:
+// - groups: The groups to describe.
+// - maxItems: The maximum number of groups to include.
+//
+// Returns:
+// - The joined description, followed by "+N more" when groups were left out.
+func describeGroups(groups []ownerGroup, maxItems int) string {
+	parts := make([]string, 0, min(len(groups), maxItems)+1)
+	for i, group := range groups {
+		if i == maxItems {
+			parts = append(parts, fmt.Sprintf("+%d more", len(groups)-maxItems))
+			break
+		}
+		parts = append(parts, group.String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+)
+
+// Summary describes the outcome of a reconcile cycle to be sent to notifiers.
+type Summary struct {
+	DryRun     bool                      // DryRun indicates whether deletions were skipped.
+	Candidates []resources.ContainerInfo // Candidates is every resource selected for pruning in the cycle.
+	Deleted    []resources.ContainerInfo // Deleted is every resource whose deletion was confirmed in the cycle.
+	Pruned     int                       // Pruned is the number of resources deleted in the cycle.
+}
+
+// Notifier delivers a per-cycle summary to an external system.
+type Notifier interface {
+	Notify(ctx context.Context, summary Summary) error
+}
+
+// notifiers fans a summary out to several notifiers, collecting every error.
+type notifiers []Notifier
+
+// Notify sends the summary to every configured notifier.
+func (n notifiers) Notify(ctx context.Context, summary Summary) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, summary); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New creates a Notifier from the configuration, combining every notifier that
+// has been configured.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A Notifier, or nil if no notifier is configured.
+func New(cfg config.Config) Notifier {
+	var configured notifiers
+	if cfg.NotifyWebhookURL != "" {
+		configured = append(configured, NewWebhook(cfg.NotifyWebhookURL, cfg.NotifyTimeout, cfg.NotifyMaxItems))
+	}
+	if cfg.SMTPHost != "" {
+		configured = append(configured, NewSMTP(cfg))
+	}
+	if len(configured) == 0 {
+		return nil
+	}
+	return configured
+}
+
+// truncate caps the items to maxItems and returns the number left out.
+//
+// Parameters:
+// - items: A slice of candidates or owner groups to cap.
+// - maxItems: The maximum number of entries to keep.
+//
+// Returns:
+// - The capped slice of items.
+// - The number of items that were dropped.
+func truncate[T any](items []T, maxItems int) ([]T, int) {
+	if len(items) <= maxItems {
+		return items, 0
+	}
+	return items[:maxItems], len(items) - maxItems
+}
+
+// grouped returns the resources notifications group by owner: what would be deleted
+// in dry run mode, and what was actually deleted otherwise.
+//
+// Parameters:
+// - summary: The cycle summary.
+//
+// Returns:
+// - The resources to group by owner.
+func grouped(summary Summary) []resources.ContainerInfo {
+	if summary.DryRun {
+		return summary.Candidates
+	}
+	return summary.Deleted
+}
+
+// headline returns a one-line, human-readable summary of the cycle.
+//
+// Parameters:
+// - summary: The cycle summary.
+// - more: The number of candidates left out of the payload.
+//
+// Returns:
+// - A short description such as "pod-pruner: 12 candidates, 10 pruned (+2 more)".
+func headline(summary Summary, more int) string {
+	text := fmt.Sprintf("pod-pruner: %d candidates, %d pruned", len(summary.Candidates), summary.Pruned)
+	if summary.DryRun {
+		text = fmt.Sprintf("pod-pruner (dry run): %d candidates would be pruned", len(summary.Candidates))
+	}
+	if more > 0 {
+		text = fmt.Sprintf("%s (+%d more)", text, more)
+	}
+	return text
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+)
+
+// SMTP emails a plain text summary of each cycle. It sends a single message per
+// cycle to every recipient, and the whole exchange with the server is bounded by
+// a timeout so an unresponsive relay cannot block the prune loop.
+type SMTP struct {
+	host     string
+	port     string
+	from     string
+	to       []string
+	username string
+	password string
+	tlsMode  string // tlsMode is "starttls", "tls" for implicit TLS, or "none".
+	maxItems int
+	timeout  time.Duration
+}
+
+// NewSMTP creates a new instance of SMTP from the SMTP_* settings.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A pointer to a new instance of SMTP.
+func NewSMTP(cfg config.Config) *SMTP {
+	return &SMTP{
+		host:     cfg.SMTPHost,
+		port:     cfg.SMTPPort,
+		from:     cfg.SMTPFrom,
+		to:       cfg.SMTPTo,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		tlsMode:  cfg.SMTPTLS,
+		maxItems: cfg.NotifyMaxItems,
+		timeout:  cfg.NotifyTimeout,
+	}
+}
+
+// Notify emails the summary to the configured recipients.
+//
+// Parameters:
+// - ctx: The context used to cancel the delivery.
+// - summary: The cycle summary to send.
+//
+// Returns:
+// - An error if the message could not be delivered.
+func (s *SMTP) Notify(ctx context.Context, summary Summary) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if s.tlsMode == "starttls" {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("failed to start tls with smtp server: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate with smtp server: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("smtp server rejected sender: %w", err)
+	}
+	for _, recipient := range s.to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("smtp server rejected recipient '%s': %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start smtp message: %w", err)
+	}
+	if _, err := writer.Write(s.message(summary)); err != nil {
+		return fmt.Errorf("failed to write smtp message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send smtp message: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial opens the connection to the SMTP server, negotiating TLS straight away
+// when implicit TLS is configured.
+//
+// Parameters:
+// - ctx: The context bounding the connection attempt.
+//
+// Returns:
+// - The established connection.
+// - An error if the connection could not be established.
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(s.host, s.port)
+	if s.tlsMode == "tls" {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: s.host}}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// message renders the summary as a plain text email, listing the candidates
+// grouped by controlling owner, one owner per line.
+//
+// Parameters:
+// - summary: The cycle summary to render.
+//
+// Returns:
+// - The full message, including headers, with CRLF line endings.
+func (s *SMTP) message(summary Summary) []byte {
+	groups, more := truncate(groupByOwner(grouped(summary)), s.maxItems)
+	subject := headline(summary, 0)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&body, "%s\r\n\r\n", subject)
+	for _, group := range groups {
+		fmt.Fprintf(&body, "- %s\r\n", group)
+	}
+	if more > 0 {
+		fmt.Fprintf(&body, "- +%d more\r\n", more)
+	}
+	return body.Bytes()
+}
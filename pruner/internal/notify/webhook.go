@@ -0,0 +1,110 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+)
+
+// Webhook posts a JSON summary of each cycle to an HTTP endpoint. Every request
+// is bounded by a timeout and the candidate list is capped, so a slow or
+// misbehaving endpoint can neither block the prune loop nor balloon memory.
+type Webhook struct {
+	url      string
+	maxItems int
+	client   *http.Client
+}
+
+// webhookPayload is the JSON document posted to the webhook.
+type webhookPayload struct {
+	Text       string                    `json:"text"`
+	DryRun     bool                      `json:"dryRun"`
+	Candidates int                       `json:"candidates"`
+	Pruned     int                       `json:"pruned"`
+	Owners     []ownerGroup              `json:"owners"`
+	Resources  []resources.ContainerInfo `json:"resources"`
+	More       int                       `json:"more,omitempty"`
+	MoreOwners int                       `json:"moreOwners,omitempty"`
+}
+
+// NewWebhook creates a new instance of Webhook.
+//
+// Parameters:
+// - url: The endpoint to POST summaries to.
+// - timeout: The maximum duration of a single request.
+// - maxItems: The maximum number of resources included in a payload.
+//
+// Returns:
+// - A pointer to a new instance of Webhook.
+func NewWebhook(url string, timeout time.Duration, maxItems int) *Webhook {
+	return &Webhook{
+		url:      url,
+		maxItems: maxItems,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify posts the summary to the webhook endpoint.
+//
+// Parameters:
+// - ctx: The context used to cancel the request.
+// - summary: The cycle summary to send.
+//
+// Returns:
+// - An error if the request failed or the endpoint did not respond with a 2xx status.
+func (w *Webhook) Notify(ctx context.Context, summary Summary) error {
+	items, more := truncate(summary.Candidates, w.maxItems)
+	groups := groupByOwner(grouped(summary))
+	owners, moreOwners := truncate(groups, w.maxItems)
+	body, err := json.Marshal(webhookPayload{
+		Text:       fmt.Sprintf("%s: %s", headline(summary, more), describeGroups(groups, w.maxItems)),
+		DryRun:     summary.DryRun,
+		Candidates: len(summary.Candidates),
+		Pruned:     summary.Pruned,
+		Owners:     owners,
+		Resources:  items,
+		More:       more,
+		MoreOwners: moreOwners,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+)
+
+// notifyWebhook sends the summary to a test server and returns the decoded payload.
+func notifyWebhook(t *testing.T, summary Summary, maxItems int) webhookPayload {
+	t.Helper()
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL, time.Second, maxItems).Notify(context.Background(), summary); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	return payload
+}
+
+// ownedPod returns a pod candidate controlled by its own StatefulSet.
+func ownedPod(i int) resources.ContainerInfo {
+	return resources.ContainerInfo{
+		Namespace: "default",
+		PodName:   fmt.Sprintf("web-%d", i),
+		OwnerKind: "StatefulSet",
+		OwnerName: fmt.Sprintf("web-%d", i),
+	}
+}
+
+func TestWebhookCapsOwners(t *testing.T) {
+	var candidates []resources.ContainerInfo
+	for i := range 5 {
+		candidates = append(candidates, ownedPod(i))
+	}
+
+	payload := notifyWebhook(t, Summary{DryRun: true, Candidates: candidates}, 2)
+	if len(payload.Owners) != 2 || len(payload.Resources) != 2 {
+		t.Errorf("got %d owners and %d resources, want 2 each", len(payload.Owners), len(payload.Resources))
+	}
+	if payload.More != 3 || payload.MoreOwners != 3 {
+		t.Errorf("More = %d and MoreOwners = %d, want 3 each", payload.More, payload.MoreOwners)
+	}
+}
+
+func TestWebhookGroupsDeleted(t *testing.T) {
+	candidates := []resources.ContainerInfo{ownedPod(0), ownedPod(1), ownedPod(2)}
+	summary := Summary{Candidates: candidates, Deleted: candidates[:1], Pruned: 1}
+
+	payload := notifyWebhook(t, summary, 10)
+	if len(payload.Owners) != 1 || payload.Owners[0].Owner != "StatefulSet/web-0" {
+		t.Errorf("Owners = %+v, want only StatefulSet/web-0", payload.Owners)
+	}
+
+	summary.DryRun = true
+	if payload := notifyWebhook(t, summary, 10); len(payload.Owners) != 3 {
+		t.Errorf("dry run Owners = %+v, want all 3 candidates", payload.Owners)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// auditSink is the sink every deletion is recorded to, nil when AUDIT_SINK_ADDR is unset.
+var auditSink atomic.Pointer[AuditSink]
+
+// deletionRecord is the NDJSON record written for every deleted resource.
+type deletionRecord struct {
+	Time     string      `json:"time"`     // Time is when the resource was deleted, in RFC 3339 format.
+	Action   string      `json:"action"`   // Action is always "deleted".
+	Kind     string      `json:"kind"`     // Kind is the kind of the deleted resource (e.g., pod, job).
+	Resource interface{} `json:"resource"` // Resource describes the deleted resource.
+}
+
+// SetAuditSink sets the sink deletions are recorded to.
+//
+// Parameters:
+// - sink: The sink to record deletions to, nil to stop recording.
+func SetAuditSink(sink *AuditSink) {
+	auditSink.Store(sink)
+}
+
+// RecordDeletion records the deletion of a resource to the audit sink, if one is set.
+// It never blocks.
+//
+// Parameters:
+// - kind: The kind of the deleted resource (e.g., pod, job).
+// - resource: A JSON-serialisable description of the deleted resource.
+func RecordDeletion(kind string, resource interface{}) {
+	sink := auditSink.Load()
+	if sink == nil {
+		return
+	}
+	sink.Write(deletionRecord{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Action:   "deleted",
+		Kind:     kind,
+		Resource: resource,
+	})
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sinkBufferSize      = 1024             // sinkBufferSize is the number of records queued while the sink is unavailable.
+	sinkDialTimeout     = 5 * time.Second  // sinkDialTimeout bounds a single connection attempt.
+	sinkWriteTimeout    = 5 * time.Second  // sinkWriteTimeout bounds writing a single record.
+	sinkMaxReconnectGap = 30 * time.Second // sinkMaxReconnectGap caps the delay between reconnection attempts.
+)
+
+// AuditSink streams NDJSON records to a Unix socket or TCP address, typically a
+// sidecar that ships them to an audit pipeline. Writes never block: records are
+// queued in a bounded buffer and dropped when it is full, and the connection is
+// re-established in the background with an increasing delay whenever it fails.
+type AuditSink struct {
+	network string
+	address string
+	records chan []byte
+	dropped atomic.Int64
+}
+
+// NewAuditSink creates a new instance of AuditSink and starts delivering records.
+//
+// Parameters:
+// - addr: The sink address, either "unix:///path/to/socket" or "[tcp://]host:port".
+//
+// Returns:
+// - A pointer to a new instance of AuditSink.
+// - An error if the address is invalid.
+func NewAuditSink(addr string) (*AuditSink, error) {
+	network, address, err := parseSinkAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	sink := &AuditSink{
+		network: network,
+		address: address,
+		records: make(chan []byte, sinkBufferSize),
+	}
+	go sink.run()
+	return sink, nil
+}
+
+// Write queues a record, encoded as a single line of JSON. It never blocks; when
+// the buffer is full the record is dropped and counted.
+//
+// Parameters:
+// - record: A JSON-serialisable record.
+func (s *AuditSink) Write(record interface{}) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{}, "Failed to encode audit record", err)
+		return
+	}
+	select {
+	case s.records <- append(line, '\n'):
+	default:
+		if dropped := s.dropped.Add(1); dropped == 1 || dropped%100 == 0 {
+			utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("dropped:%d", dropped)}, "Audit sink buffer full, dropping records")
+		}
+	}
+}
+
+// run delivers queued records, reconnecting whenever the connection fails. A record
+// that could not be written is retried on the next connection.
+func (s *AuditSink) run() {
+	var conn net.Conn
+	delay := time.Second
+	for line := range s.records {
+		for {
+			if conn == nil {
+				var err error
+				if conn, err = net.DialTimeout(s.network, s.address, sinkDialTimeout); err != nil {
+					utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("address:%s", s.address), fmt.Sprintf("retry:%s", delay)}, "Audit sink unavailable", err)
+					conn = nil
+					time.Sleep(delay)
+					delay = min(delay*2, sinkMaxReconnectGap)
+					continue
+				}
+				delay = time.Second
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+			if _, err := conn.Write(line); err != nil {
+				utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("address:%s", s.address)}, "Audit sink write failed, reconnecting", err)
+				conn.Close()
+				conn = nil
+				continue
+			}
+			break
+		}
+	}
+}
+
+// parseSinkAddr splits a sink address into the network and address used to dial it.
+//
+// Parameters:
+// - addr: The sink address, either "unix:///path/to/socket" or "[tcp://]host:port".
+//
+// Returns:
+// - The network, "unix" or "tcp".
+// - The address to dial.
+// - An error if the address is invalid.
+func parseSinkAddr(addr string) (string, string, error) {
+	if path, isUnix := strings.CutPrefix(addr, "unix://"); isUnix {
+		if path == "" {
+			return "", "", fmt.Errorf("audit sink address '%s' has no socket path", addr)
+		}
+		return "unix", path, nil
+	}
+	address := strings.TrimPrefix(addr, "tcp://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("audit sink address '%s' must be unix:///path or host:port: %w", addr, err)
+	}
+	return "tcp", address, nil
+}
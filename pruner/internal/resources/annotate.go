@@ -0,0 +1,67 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// annotatePod merges the given annotations into the pod's metadata, leaving every
+// other annotation untouched. It is the single patch path for marking pods, so
+// anything that labels or annotates instead of deleting should go through it.
+//
+// Parameters:
+// - ctx: The context used to cancel the request.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace of the pod.
+// - name: The name of the pod.
+// - annotations: The annotations to set.
+//
+// Returns:
+// - An error if the patch could not be encoded or applied.
+func annotatePod(ctx context.Context, clientset kubernetes.Interface, namespace, name string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode annotation patch: %w", err)
+	}
+	_, err = clientset.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// selectionReason describes why a resource was selected for pruning, in the format
+// "rule=RULE state=STATUS age=AGE", with the container appended when known.
+//
+// Parameters:
+// - item: The selected resource.
+//
+// Returns:
+// - The human-readable selection reason.
+func selectionReason(item ContainerInfo) string {
+	reason := fmt.Sprintf("rule=%s state=%s age=%s", item.Rule, item.Status, item.Age())
+	if item.ContainerName != "" {
+		reason = fmt.Sprintf("%s container=%s", reason, item.ContainerName)
+	}
+	return reason
+}
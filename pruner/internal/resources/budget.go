@@ -0,0 +1,213 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// budgetWindow is the sliding window NAMESPACE_HOURLY_BUDGET applies to.
+const budgetWindow = time.Hour
+
+// DeletionBudget caps the number of deletions per namespace over a sliding hour, so
+// a bad rule cannot slowly but steadily delete everything across many cycles. It is
+// kept in memory for the lifetime of the process and shared by every cycle, and can
+// be persisted to a BudgetStore so restarts do not reset it.
+type DeletionBudget struct {
+	limit     int
+	mu        sync.Mutex
+	deletions map[string][]time.Time
+	dirty     bool
+}
+
+// NewDeletionBudget creates a new instance of DeletionBudget.
+//
+// Parameters:
+// - limit: The number of deletions allowed per namespace per hour, 0 or less disables the budget.
+//
+// Returns:
+// - A pointer to a new instance of DeletionBudget, or nil if the budget is disabled.
+func NewDeletionBudget(limit int) *DeletionBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &DeletionBudget{limit: limit, deletions: make(map[string][]time.Time)}
+}
+
+// Reserve takes one deletion from the namespace budget. Every successful call must be
+// followed by a call to Refund if the deletion then fails. A nil budget always allows.
+//
+// Parameters:
+// - namespace: The namespace the deletion is made in.
+//
+// Returns:
+// - A boolean indicating whether the budget allowed the deletion.
+func (b *DeletionBudget) Reserve(namespace string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recent := b.recent(namespace, time.Now())
+	if len(recent) >= b.limit {
+		return false
+	}
+	b.deletions[namespace] = append(recent, time.Now())
+	b.dirty = true
+	b.publish(namespace)
+	return true
+}
+
+// Refund gives back a deletion taken with Reserve that did not happen.
+//
+// Parameters:
+// - namespace: The namespace the deletion was to be made in.
+func (b *DeletionBudget) Refund(namespace string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if recent := b.deletions[namespace]; len(recent) > 0 {
+		b.deletions[namespace] = recent[:len(recent)-1]
+		b.dirty = true
+	}
+	b.publish(namespace)
+}
+
+// Restore loads the deletions persisted by a previous process, keeping those still
+// within the window. It does nothing for a nil budget or store.
+//
+// Parameters:
+// - ctx: The context bounding the store calls.
+// - store: The BudgetStore the deletions were persisted to.
+//
+// Returns:
+// - An error if the persisted deletions could not be loaded or decoded.
+func (b *DeletionBudget) Restore(ctx context.Context, store BudgetStore) error {
+	if b == nil || store == nil {
+		return nil
+	}
+	state, err := store.Load(ctx)
+	if err != nil || len(state) == 0 {
+		return err
+	}
+	var deletions map[string][]time.Time
+	if err := json.Unmarshal(state, &deletions); err != nil {
+		return fmt.Errorf("failed to decode persisted deletion budget: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for namespace, times := range deletions {
+		b.deletions[namespace] = append(times, b.deletions[namespace]...)
+		b.recent(namespace, now)
+		b.publish(namespace)
+	}
+	return nil
+}
+
+// Flush persists the deletions within the window to the store, if any changed since
+// the last flush. It does nothing for a nil budget or store.
+//
+// Parameters:
+// - ctx: The context bounding the store calls.
+// - store: The BudgetStore to persist the deletions to.
+//
+// Returns:
+// - An error if the deletions could not be persisted, in which case the next flush retries.
+func (b *DeletionBudget) Flush(ctx context.Context, store BudgetStore) error {
+	if b == nil || store == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	for namespace := range b.deletions {
+		if len(b.recent(namespace, now)) == 0 {
+			delete(b.deletions, namespace)
+		}
+	}
+	state, err := json.Marshal(b.deletions)
+	b.dirty = false
+	b.mu.Unlock()
+	if err == nil {
+		err = store.Save(ctx, state)
+	}
+	if err != nil {
+		b.mu.Lock()
+		b.dirty = true
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// Persist flushes the budget to the store every interval until ctx is done. Failures
+// are logged and the budget keeps being enforced in memory.
+//
+// Parameters:
+// - ctx: The context stopping the flushes.
+// - store: The BudgetStore to persist the deletions to.
+// - interval: How often the deletions are flushed (BUDGET_FLUSH_INTERVAL).
+func (b *DeletionBudget) Persist(ctx context.Context, store BudgetStore, interval time.Duration) {
+	if b == nil || store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Flush(ctx, store); err != nil {
+				utils.LogWithFields(logrus.WarnLevel, []string{}, "Failed to persist deletion budget, keeping it in memory", err)
+			}
+		}
+	}
+}
+
+// recent drops the deletions of the namespace that fell out of the window and
+// returns the remaining ones. The caller must hold mu.
+func (b *DeletionBudget) recent(namespace string, now time.Time) []time.Time {
+	deletions := b.deletions[namespace]
+	cutoff := now.Add(-budgetWindow)
+	for len(deletions) > 0 && !deletions[0].After(cutoff) {
+		deletions = deletions[1:]
+	}
+	b.deletions[namespace] = deletions
+	return deletions
+}
+
+// publish updates the remaining budget gauge of the namespace. The caller must hold mu.
+func (b *DeletionBudget) publish(namespace string) {
+	metrics.DeletionBudgetRemaining.WithLabelValues(namespace).Set(float64(b.limit - len(b.deletions[namespace])))
+}
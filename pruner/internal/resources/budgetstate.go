@@ -0,0 +1,156 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// budgetStateKey is the key of the BUDGET_STATE_CONFIGMAP holding the persisted deletions.
+const budgetStateKey = "deletions.json"
+
+// BudgetStore persists the deletions counted by a DeletionBudget, so the sliding
+// window survives restarts.
+type BudgetStore interface {
+	// Load returns the persisted state, or nil if nothing was persisted yet.
+	Load(ctx context.Context) ([]byte, error)
+	// Save replaces the persisted state.
+	Save(ctx context.Context, state []byte) error
+}
+
+// NewBudgetStore creates the BudgetStore configured with BUDGET_STATE_CONFIGMAP or
+// BUDGET_STATE_FILE.
+//
+// Parameters:
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A BudgetStore, or nil if the budget is kept in memory only.
+func NewBudgetStore(clientset kubernetes.Interface, cfg config.Config) BudgetStore {
+	if cfg.BudgetStateConfigMap != "" {
+		namespace, name, _ := strings.Cut(cfg.BudgetStateConfigMap, "/")
+		return &configMapBudgetStore{clientset: clientset, namespace: namespace, name: name}
+	}
+	if cfg.BudgetStateFile != "" {
+		return fileBudgetStore(cfg.BudgetStateFile)
+	}
+	return nil
+}
+
+// fileBudgetStore persists the budget to a file, typically on a persistent volume.
+type fileBudgetStore string
+
+// Load reads the file, returning nil if it does not exist yet.
+func (f fileBudgetStore) Load(_ context.Context) ([]byte, error) {
+	state, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget state file '%s': %w", string(f), err)
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file renamed over the file, so a crash never
+// leaves it half written.
+func (f fileBudgetStore) Save(_ context.Context, state []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(string(f)), ".budget-*")
+	if err != nil {
+		return fmt.Errorf("failed to write budget state file '%s': %w", string(f), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(state); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write budget state file '%s': %w", string(f), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write budget state file '%s': %w", string(f), err)
+	}
+	if err := os.Rename(tmp.Name(), string(f)); err != nil {
+		return fmt.Errorf("failed to write budget state file '%s': %w", string(f), err)
+	}
+	return nil
+}
+
+// configMapBudgetStore persists the budget to a ConfigMap, created on first save.
+type configMapBudgetStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// Load reads the ConfigMap, returning nil if it does not exist yet.
+func (c *configMapBudgetStore) Load(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	configMap, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget state configmap '%s/%s': %w", c.namespace, c.name, err)
+	}
+	return []byte(configMap.Data[budgetStateKey]), nil
+}
+
+// Save updates the ConfigMap, creating it if it does not exist.
+func (c *configMapBudgetStore) Save(ctx context.Context, state []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	configMaps := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	configMap, err := configMaps.Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: c.namespace, Labels: utils.RecommendedLabels()},
+			Data:       map[string]string{budgetStateKey: string(state)},
+		}, metav1.CreateOptions{})
+	} else if err == nil {
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string, 1)
+		}
+		configMap.Data[budgetStateKey] = string(state)
+		// Label ConfigMaps created by hand or by older versions as pod-pruner's too.
+		if configMap.Labels == nil {
+			configMap.Labels = make(map[string]string)
+		}
+		for key, value := range utils.RecommendedLabels() {
+			configMap.Labels[key] = value
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save budget state configmap '%s/%s': %w", c.namespace, c.name, err)
+	}
+	return nil
+}
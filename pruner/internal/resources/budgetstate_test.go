@@ -0,0 +1,69 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapBudgetStoreSave(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	store := &configMapBudgetStore{clientset: clientset, namespace: "pod-pruner", name: "pod-pruner-budget"}
+	if err := store.Save(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps("pod-pruner").Get(context.Background(), "pod-pruner-budget", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the budget state configmap: %v", err)
+	}
+	if !reflect.DeepEqual(configMap.Labels, utils.RecommendedLabels()) {
+		t.Errorf("Labels = %v, want %v", configMap.Labels, utils.RecommendedLabels())
+	}
+	if got := configMap.Data[budgetStateKey]; got != `{}` {
+		t.Errorf("Data[%s] = %q, want {}", budgetStateKey, got)
+	}
+}
+
+func TestConfigMapBudgetStoreSaveLabelsExisting(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod-pruner-budget",
+		Namespace: "pod-pruner",
+		Labels:    map[string]string{"team": "platform"},
+	}})
+	store := &configMapBudgetStore{clientset: clientset, namespace: "pod-pruner", name: "pod-pruner-budget"}
+	if err := store.Save(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps("pod-pruner").Get(context.Background(), "pod-pruner-budget", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the budget state configmap: %v", err)
+	}
+	want := utils.RecommendedLabels()
+	want["team"] = "platform"
+	if !reflect.DeepEqual(configMap.Labels, want) {
+		t.Errorf("Labels = %v, want %v", configMap.Labels, want)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/report"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unreferenced is the status reported for ConfigMaps that nothing refers to.
+const unreferenced = "Unreferenced"
+
+// protectedConfigMaps are ConfigMaps published into every namespace by the control
+// plane. They are never pruned, even when no pod mounts them.
+var protectedConfigMaps = []string{"kube-root-ca.crt"}
+
+// GetOrphanConfigMaps retrieves the ConfigMaps in the specified namespace that are
+// older than CONFIGMAP_TTL and referenced by nothing. References are collected from
+// the volumes, projected volumes, env and envFrom of every pod, and of the pod
+// templates of every Deployment, StatefulSet, DaemonSet, ReplicaSet, Job and CronJob,
+// so ConfigMaps used by scaled-down or suspended workloads are kept.
+// ConfigMaps with owner references, leader election records, control plane ConfigMaps,
+// pod-pruner's own KILL_SWITCH_CONFIGMAP and BUDGET_STATE_CONFIGMAP, and ConfigMaps
+// protected by PROTECT_ANNOTATION are never selected. If any of the lists fails,
+// nothing is selected.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace from which to retrieve the ConfigMaps.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of ContainerInfo, each describing an unreferenced ConfigMap.
+// - An error if any of the lists fails.
+func GetOrphanConfigMaps(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configmaps in namespace '%s': %w", namespace, err)
+	}
+	if len(configMaps.Items) == 0 {
+		return nil, nil
+	}
+
+	referenced, err := referencedConfigMaps(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []ContainerInfo
+	for _, configMap := range configMaps.Items {
+		if _, exists := referenced[configMap.Name]; exists {
+			continue
+		}
+		if utils.Contains(protectedConfigMaps, configMap.Name) || len(configMap.OwnerReferences) > 0 || isLeaderElectionRecord(configMap) {
+			continue
+		}
+		if isPrunerConfigMap(configMap, cfg) || isProtected(ctx, configMap.ObjectMeta, "configmap", cfg.ProtectAnnotation) {
+			continue
+		}
+		if time.Since(configMap.CreationTimestamp.Time) <= cfg.ConfigMapTTL {
+			continue
+		}
+		orphans = append(orphans, ContainerInfo{
+			Namespace: configMap.Namespace,
+			PodName:   configMap.Name,
+			Status:    unreferenced,
+			Rule:      "ORPHAN_CONFIGMAPS",
+			CreatedAt: configMap.CreationTimestamp.Time,
+		})
+	}
+	countScanned(ctx, len(configMaps.Items))
+	return orphans, nil
+}
+
+// isPrunerConfigMap checks whether the ConfigMap is one pod-pruner itself reads or
+// writes, KILL_SWITCH_CONFIGMAP or BUDGET_STATE_CONFIGMAP, which nothing mounts.
+//
+// Parameters:
+// - configMap: The ConfigMap to check.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A boolean indicating whether the ConfigMap belongs to pod-pruner.
+func isPrunerConfigMap(configMap v1.ConfigMap, cfg config.Config) bool {
+	key := fmt.Sprintf("%s/%s", configMap.Namespace, configMap.Name)
+	return key == cfg.KillSwitchConfigMap || key == cfg.BudgetStateConfigMap
+}
+
+// referencedConfigMaps collects the names of every ConfigMap referenced by a pod or
+// a workload pod template in the given namespace.
+//
+// Parameters:
+// - ctx: The context bounding the list calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace to inspect.
+//
+// Returns:
+// - A set of referenced ConfigMap names.
+// - An error if any of the lists fails.
+func referencedConfigMaps(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]struct{}, error) {
+	referenced := make(map[string]struct{})
+	opts := metav1.ListOptions{}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace '%s': %w", namespace, err)
+	}
+	for _, pod := range pods.Items {
+		addConfigMapReferences(pod.Spec, referenced)
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace '%s': %w", namespace, err)
+	}
+	for _, deployment := range deployments.Items {
+		addConfigMapReferences(deployment.Spec.Template.Spec, referenced)
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace '%s': %w", namespace, err)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		addConfigMapReferences(statefulSet.Spec.Template.Spec, referenced)
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets in namespace '%s': %w", namespace, err)
+	}
+	for _, daemonSet := range daemonSets.Items {
+		addConfigMapReferences(daemonSet.Spec.Template.Spec, referenced)
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets in namespace '%s': %w", namespace, err)
+	}
+	for _, replicaSet := range replicaSets.Items {
+		addConfigMapReferences(replicaSet.Spec.Template.Spec, referenced)
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs in namespace '%s': %w", namespace, err)
+	}
+	for _, job := range jobs.Items {
+		addConfigMapReferences(job.Spec.Template.Spec, referenced)
+	}
+
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs in namespace '%s': %w", namespace, err)
+	}
+	for _, cronJob := range cronJobs.Items {
+		addConfigMapReferences(cronJob.Spec.JobTemplate.Spec.Template.Spec, referenced)
+	}
+
+	return referenced, nil
+}
+
+// addConfigMapReferences adds every ConfigMap referenced by the pod spec's volumes,
+// projected volumes, env and envFrom to the given set.
+//
+// Parameters:
+// - spec: The pod spec to inspect.
+// - referenced: The set of referenced ConfigMap names to add to.
+func addConfigMapReferences(spec v1.PodSpec, referenced map[string]struct{}) {
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			referenced[volume.ConfigMap.Name] = struct{}{}
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					referenced[source.ConfigMap.Name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	containers := append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, ephemeral := range spec.EphemeralContainers {
+		containers = append(containers, v1.Container(ephemeral.EphemeralContainerCommon))
+	}
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				referenced[envFrom.ConfigMapRef.Name] = struct{}{}
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				referenced[env.ValueFrom.ConfigMapKeyRef.Name] = struct{}{}
+			}
+		}
+	}
+}
+
+// isLeaderElectionRecord checks whether the ConfigMap is used as a leader election
+// lock, which is never mounted but must not be deleted.
+//
+// Parameters:
+// - configMap: The ConfigMap to check.
+//
+// Returns:
+// - A boolean indicating whether the ConfigMap holds a leader election record.
+func isLeaderElectionRecord(configMap v1.ConfigMap) bool {
+	_, exists := configMap.Annotations["control-plane.alpha.kubernetes.io/leader"]
+	return exists
+}
+
+// DeleteConfigMaps deletes the specified ConfigMaps and logs the actions taken.
+// Deletions run concurrently, bounded by the given DeleteLimiter, and throttled deletions are retried.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset to interact with the Kubernetes API.
+// - configMaps: A slice of ContainerInfo, each describing a ConfigMap to delete.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - log: A logger to log messages.
+//
+// Returns:
+// - The number of ConfigMaps that were successfully deleted.
+func DeleteConfigMaps(ctx context.Context, clientset kubernetes.Interface, configMaps []ContainerInfo, limiter *DeleteLimiter, log *logrus.Logger) int {
+	deletions := make([]deletion, 0, len(configMaps))
+	for _, configMap := range configMaps {
+		deletions = append(deletions, deletion{
+			kind:      "configmap",
+			namespace: configMap.Namespace,
+			fields:    []string{fmt.Sprintf("configmap:%s", configMap.PodName), fmt.Sprintf("namespace:%s", configMap.Namespace)},
+			items:     []ContainerInfo{configMap},
+			delete: func(ctx context.Context) error {
+				return clientset.CoreV1().ConfigMaps(configMap.Namespace).Delete(ctx, configMap.PodName, metav1.DeleteOptions{})
+			},
+			get: func(ctx context.Context) (metav1.Object, error) {
+				return clientset.CoreV1().ConfigMaps(configMap.Namespace).Get(ctx, configMap.PodName, metav1.GetOptions{})
+			},
+			pruned: func() {
+				metrics.ConfigMapsPruned.WithLabelValues(configMap.Namespace, configMap.Status).Add(1) // Increment the counter
+				report.RecordDeletion("configmap", configMap)
+			},
+		})
+	}
+	return deleteResources(ctx, limiter, deletions)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// staleConfigMap returns an unreferenced ConfigMap in the pod-pruner namespace created a day ago.
+func staleConfigMap(name string, annotations map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "pod-pruner",
+		Annotations:       annotations,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-24 * time.Hour)),
+	}}
+}
+
+func TestGetOrphanConfigMapsExclusions(t *testing.T) {
+	tests := []struct {
+		name      string
+		configMap *v1.ConfigMap
+		cfg       config.Config
+		want      bool
+	}{
+		{name: "unreferenced configmap", configMap: staleConfigMap("stale", nil), want: true},
+		{
+			name:      "protect annotation",
+			configMap: staleConfigMap("stale", map[string]string{"pod-pruner/protect": "true"}),
+			cfg:       config.Config{ProtectAnnotation: "pod-pruner/protect"},
+		},
+		{
+			name:      "kill switch",
+			configMap: staleConfigMap("kill-switch", nil),
+			cfg:       config.Config{KillSwitchConfigMap: "pod-pruner/kill-switch"},
+		},
+		{
+			name:      "budget state",
+			configMap: staleConfigMap("budget", nil),
+			cfg:       config.Config{BudgetStateConfigMap: "pod-pruner/budget"},
+		},
+		{
+			name:      "kill switch of the same name in another namespace",
+			configMap: staleConfigMap("kill-switch", nil),
+			cfg:       config.Config{KillSwitchConfigMap: "default/kill-switch"},
+			want:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ConfigMapTTL = time.Hour
+			got, err := GetOrphanConfigMaps(context.Background(), fake.NewSimpleClientset(tt.configMap), "pod-pruner", tt.cfg)
+			if err != nil {
+				t.Fatalf("GetOrphanConfigMaps() error = %v", err)
+			}
+			if selected := len(got) == 1; selected != tt.want {
+				t.Errorf("GetOrphanConfigMaps() = %+v, want selected %v", got, tt.want)
+			}
+		})
+	}
+}
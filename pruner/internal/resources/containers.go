@@ -19,11 +19,13 @@ package resources
 import (
 	"context"
 	"fmt"
-	"os"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
 	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/report"
 	"github.com/saidsef/pod-pruner/pruner/utils"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
@@ -32,49 +34,223 @@ import (
 )
 
 // GetContainers retrieves a list of container names from pods in the specified namespace
-// that are in the states defined by the CONTAINER_STATUSES environment variable.
-// It returns a slice of container names in the format "namespace/podName: containerName".
-// If the environment variable is not set or is empty, an error is returned.
+// that are in the states defined by CONTAINER_STATUSES.
+// When POD_TTL_AFTER_FINISHED is set, pods in a terminal phase (Succeeded or Failed)
+// whose containers all finished longer ago than the TTL are selected as well.
+// When CRASHLOOP_MIN_DURATION is set, containers in CrashLoopBackOff are selected once
+// they have been looping for at least that long, and not before.
+// When SKIP_PVC_MOUNTERS is enabled, pods referencing a PersistentVolumeClaim are never selected.
+// Pods scheduled by a scheduler listed in SCHEDULER_NAME_EXCLUDE are never selected.
+// When SKIP_IF_ANY_RUNNING is enabled, pods with at least one running container are never selected.
+// When RESPECT_MIN_READY is enabled, pods younger than their owner's minReadySeconds are skipped.
+// When SKIP_SERVICE_ENDPOINTS is enabled, pods that are ready endpoints of a Service are skipped.
+// When IMAGE_PULL_MIN_AGE is set, containers failing to pull their image are selected once
+// the pod has been trying for at least that long, and not before.
+// When MAX_RESTART_RATE is set, containers restarting more often than that per hour are selected.
+// When POD_CONDITIONS is set, pods carrying a matching condition (e.g., PodScheduled=False
+// with reason Unschedulable) are selected as a whole, even without container statuses.
+// When STATUS_MATCH_ALL is enabled, a pod is only selected once all of its containers match.
+// When CONTAINER_GRANULARITY is "container", containers matching in a pod whose other
+// containers do not are logged and counted as observed instead of selected.
+// When ONLY_ORPHANS is enabled, only pods without any owner references are considered.
+// Pods running an image matching DELETE_IMAGE_DENYLIST are skipped, and when
+// DELETE_IMAGE_ALLOWLIST is set only pods running a matching image are considered.
+// The resources requested by the selected pods are published as the reclaimable gauges,
+// in dry run mode too. When NODE_NAME is set, only pods bound to that node are listed.
+// With DRY_RUN_VERBOSE in dry run mode, every pod or container that is not selected is
+// logged with the reason.
+// Only pods matching POD_LABEL_SELECTOR are listed, and they must be older than POD_MIN_AGE when set. All
+// predicates (see podPredicates) are combined with AND, and a pod passing them is selected by any matching rule.
 // If there is an error while listing the pods, it returns an error with context.
 //
 // Parameters:
+// - ctx: The context bounding the API calls.
 // - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
 // - namespace: The namespace from which to retrieve the pods.
+// - cfg: The pruner configuration.
 //
 // Returns:
 // - A slice of ContainerInfo containing the names of the containers in the specified states.
-// - An error if the environment variable is not set, empty, or if there is an error
-// while listing the pods.
-func GetContainers(clientset *kubernetes.Clientset, namespace string) ([]ContainerInfo, error) {
-	statuses := strings.Split(os.Getenv("CONTAINER_STATUSES"), ",")
-	if len(statuses) == 0 || (len(statuses) == 1 && statuses[0] == "") {
-		return nil, fmt.Errorf("CONTAINER_STATUSES environment variable is not set or empty")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// - An error if there is an error while listing the pods.
+func GetContainers(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	var containers []ContainerInfo
 	var continueToken string
+	var scanned int
+	var reclaimableCPU, reclaimableMemory float64
+	predicates := podPredicates(ctx, cfg, newMinReadyCache(ctx, clientset), newServiceEndpoints(ctx, clientset))
 
 	for {
 		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-			Continue: continueToken,
+			LabelSelector: labelSelector(cfg.PodLabelSelector),
+			FieldSelector: podFieldSelector(cfg),
+			Continue:      continueToken,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to list pods in namespace '%s': %w", namespace, err)
 		}
+		metrics.PodsScanned.WithLabelValues(namespace).Add(float64(len(podList.Items)))
+		scanned += len(podList.Items)
 
 		for _, pod := range podList.Items {
+			// Check the pod as a whole first, so excluded pods are skipped before any rule is matched.
+			if setting := rejectedBy(pod, predicates); setting != "" {
+				logSkipped(ctx, cfg, pod, "", fmt.Sprintf("excluded by %s", setting))
+				continue
+			}
+
+			ownerKind, ownerName := controllerOf(&pod)
+
+			if cfg.PodTTLAfterFinished > 0 && isFinishedPastTTL(pod, cfg.PodTTLAfterFinished) {
+				containers = append(containers, ContainerInfo{
+					Namespace: pod.Namespace,
+					PodName:   pod.Name,
+					Image:     containerImage(pod, ""),
+					Status:    string(pod.Status.Phase),
+					Rule:      "POD_TTL_AFTER_FINISHED",
+					OwnerKind: ownerKind,
+					OwnerName: ownerName,
+					CreatedAt: pod.CreationTimestamp.Time,
+				})
+				cpu, memory := podRequests(pod)
+				reclaimableCPU, reclaimableMemory = reclaimableCPU+cpu, reclaimableMemory+memory
+				continue
+			}
+
+			// Pods that never got far enough to have container statuses are selected by their conditions.
+			if condition, matched := matchingPodCondition(pod, cfg.PodConditions); matched {
+				status := condition.Reason
+				if status == "" {
+					status = string(condition.Type)
+				}
+				containers = append(containers, ContainerInfo{
+					Namespace: pod.Namespace,
+					PodName:   pod.Name,
+					Image:     containerImage(pod, ""),
+					Status:    status,
+					Condition: config.PodCondition{Type: string(condition.Type), Status: string(condition.Status), Reason: condition.Reason}.String(),
+					Message:   condition.Message,
+					Rule:      "POD_CONDITIONS",
+					OwnerKind: ownerKind,
+					OwnerName: ownerName,
+					CreatedAt: pod.CreationTimestamp.Time,
+				})
+				cpu, memory := podRequests(pod)
+				reclaimableCPU, reclaimableMemory = reclaimableCPU+cpu, reclaimableMemory+memory
+				continue
+			}
+
+			var matches []ContainerInfo
 			for _, containerStatus := range pod.Status.ContainerStatuses {
-				if isContainerInState(containerStatus, statuses) {
-					containers = append(containers, ContainerInfo{
-						Namespace: pod.Namespace,
-						PodName:   pod.Name,
-						Status:    containerStatus.State.Terminated.Reason,
-					})
+				// Failing image pulls are only selected once they outlast transient registry errors.
+				if cfg.ImagePullMinAge > 0 && isPullFailing(containerStatus) {
+					if pullFailureAge(pod) >= cfg.ImagePullMinAge {
+						matches = append(matches, ContainerInfo{
+							Namespace:     pod.Namespace,
+							PodName:       pod.Name,
+							ContainerName: containerStatus.Name,
+							Image:         containerImage(pod, containerStatus.Name),
+							Status:        containerStatus.State.Waiting.Reason,
+							StateSource:   "waiting",
+							Message:       containerStatus.State.Waiting.Message,
+							Rule:          "IMAGE_PULL_MIN_AGE",
+							OwnerKind:     ownerKind,
+							OwnerName:     ownerName,
+							CreatedAt:     pod.CreationTimestamp.Time,
+						})
+					} else {
+						logSkipped(ctx, cfg, pod, containerStatus.Name, "image pull failing for less than IMAGE_PULL_MIN_AGE")
+					}
+					continue
+				}
+				// Crash looping containers are only selected once they have been looping long enough.
+				if cfg.CrashLoopMinDuration > 0 && isCrashLooping(containerStatus) {
+					if crashLoopDuration(pod, containerStatus) >= cfg.CrashLoopMinDuration {
+						matches = append(matches, ContainerInfo{
+							Namespace:     pod.Namespace,
+							PodName:       pod.Name,
+							ContainerName: containerStatus.Name,
+							Image:         containerStatus.Image,
+							Status:        crashLoopBackOff,
+							Rule:          "CRASHLOOP_MIN_DURATION",
+							OwnerKind:     ownerKind,
+							OwnerName:     ownerName,
+							CreatedAt:     pod.CreationTimestamp.Time,
+						})
+					} else {
+						logSkipped(ctx, cfg, pod, containerStatus.Name, "crash looping for less than CRASHLOOP_MIN_DURATION")
+					}
+					continue
 				}
+				// Flapping containers are selected once they restart faster than MAX_RESTART_RATE.
+				if cfg.MaxRestartRate > 0 {
+					if rate, ok := restartRate(pod, containerStatus); ok && rate > cfg.MaxRestartRate {
+						matches = append(matches, ContainerInfo{
+							Namespace:     pod.Namespace,
+							PodName:       pod.Name,
+							ContainerName: containerStatus.Name,
+							Image:         containerStatus.Image,
+							Status:        highRestartRate,
+							Message:       fmt.Sprintf("%.1f restarts per hour", rate),
+							Rule:          "MAX_RESTART_RATE",
+							OwnerKind:     ownerKind,
+							OwnerName:     ownerName,
+							CreatedAt:     pod.CreationTimestamp.Time,
+						})
+						continue
+					}
+				}
+				if reason, source, message, matched := isContainerInState(containerStatus, cfg.ContainerStatuses, cfg.StatusPatterns, cfg.ContainerMessageContains, cfg.UseLastTermination); matched {
+					// Give containers that died recently time to be inspected before they are pruned.
+					if cfg.LastTerminationTTL > 0 && !finishedLongerAgo(pod, cfg.LastTerminationTTL) {
+						logSkipped(ctx, cfg, pod, containerStatus.Name, fmt.Sprintf("%s more recently than LAST_TERMINATION_TTL", reason))
+						continue
+					}
+					info := ContainerInfo{
+						Namespace:     pod.Namespace,
+						PodName:       pod.Name,
+						ContainerName: containerStatus.Name,
+						Image:         containerStatus.Image,
+						Status:        reason,
+						StateSource:   source,
+						Message:       message,
+						Rule:          "CONTAINER_STATUSES",
+						OwnerKind:     ownerKind,
+						OwnerName:     ownerName,
+						CreatedAt:     pod.CreationTimestamp.Time,
+					}
+					if isOOMKilled(containerStatus) {
+						info.MemoryLimit, info.CPULimit = containerLimits(pod, containerStatus.Name)
+					}
+					matches = append(matches, info)
+					continue
+				}
+				logSkipped(ctx, cfg, pod, containerStatus.Name, "no rule matched")
+			}
+
+			// With STATUS_MATCH_ALL, a pod is only selected when every one of its containers matched.
+			if cfg.StatusMatchAll && len(matches) != len(pod.Status.ContainerStatuses) {
+				if len(matches) > 0 {
+					logSkipped(ctx, cfg, pod, "", fmt.Sprintf("%d of %d containers matched, STATUS_MATCH_ALL requires all", len(matches), len(pod.Status.ContainerStatuses)))
+				}
+				continue
 			}
+			// With CONTAINER_GRANULARITY=container, healthy containers are never taken down with a
+			// crashed one: partial matches are only reported as observed.
+			if cfg.ContainerGranularity == "container" && len(matches) > 0 && len(matches) != len(pod.Status.ContainerStatuses) {
+				for _, match := range matches {
+					metrics.ContainersObserved.WithLabelValues(match.Namespace, metrics.StateLabel(match.Status)).Inc()
+					utils.LogWithFieldsContext(ctx, logrus.InfoLevel, []string{fmt.Sprintf("pod:%s", match.PodName), fmt.Sprintf("namespace:%s", match.Namespace), fmt.Sprintf("container:%s", match.ContainerName), fmt.Sprintf("status:%s", match.Status)}, "Container observed but not pruned, other containers of the pod are healthy")
+				}
+				continue
+			}
+			if len(matches) > 0 {
+				cpu, memory := podRequests(pod)
+				reclaimableCPU, reclaimableMemory = reclaimableCPU+cpu, reclaimableMemory+memory
+			}
+			containers = append(containers, matches...)
 		}
 
 		if podList.Continue == "" {
@@ -83,31 +259,333 @@ func GetContainers(clientset *kubernetes.Clientset, namespace string) ([]Contain
 		continueToken = podList.Continue
 	}
 
+	metrics.ReclaimableCPU.WithLabelValues(namespace).Set(reclaimableCPU)
+	metrics.ReclaimableMemory.WithLabelValues(namespace).Set(reclaimableMemory)
+	countScanned(ctx, scanned)
 	return containers, nil
 }
 
+// logSkipped logs why a pod or one of its containers was not selected, only with
+// DRY_RUN_VERBOSE in dry run mode so rules can be validated against every decision.
+//
+// Parameters:
+// - ctx: The context carrying the log buffer, if any.
+// - cfg: The pruner configuration.
+// - pod: The pod that was not selected.
+// - container: The name of the container that was not selected, empty for the whole pod.
+// - reason: Why it was not selected (e.g., excluded by SKIP_PVC_MOUNTERS).
+func logSkipped(ctx context.Context, cfg config.Config, pod v1.Pod, container, reason string) {
+	if !cfg.DryRun || !cfg.DryRunVerbose {
+		return
+	}
+	fields := []string{fmt.Sprintf("pod:%s", pod.Name), fmt.Sprintf("namespace:%s", pod.Namespace), fmt.Sprintf("reason:%s", reason)}
+	if container != "" {
+		fields = append(fields, fmt.Sprintf("container:%s", container))
+	}
+	utils.LogWithFieldsContext(ctx, logrus.InfoLevel, fields, "Dry run mode. Not selected for pruning")
+}
+
+// hasProtectedOwner checks whether any owner reference of the pod is of a protected kind.
+// When protectedKinds is empty and skipControlled is set, every owned pod is protected.
+//
+// Parameters:
+// - pod: The pod to check.
+// - skipControlled: A boolean indicating whether pods with owners are protected.
+// - protectedKinds: A slice of owner kinds (e.g., StatefulSet) whose pods are protected.
+//
+// Returns:
+// - A boolean indicating whether the pod is owned by a protected kind.
+func hasProtectedOwner(pod v1.Pod, skipControlled bool, protectedKinds []string) bool {
+	if len(protectedKinds) == 0 {
+		return skipControlled && len(pod.OwnerReferences) > 0
+	}
+	for _, owner := range pod.OwnerReferences {
+		if utils.Contains(protectedKinds, owner.Kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountsPersistentVolumeClaim checks whether the given pod references a
+// PersistentVolumeClaim in any of its volumes.
+//
+// Parameters:
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether the pod mounts a PersistentVolumeClaim.
+func mountsPersistentVolumeClaim(pod v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// runsMatchingImage checks whether any init or regular container of the pod runs an
+// image matching one of the given regular expressions.
+//
+// Parameters:
+// - pod: The pod to check.
+// - patterns: A slice of compiled regular expressions to match images against.
+//
+// Returns:
+// - A boolean indicating whether any container image matches.
+func runsMatchingImage(pod v1.Pod, patterns []*regexp.Regexp) bool {
+	for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		for _, pattern := range patterns {
+			if pattern.MatchString(container.Image) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containerImage returns the image of the named container in the pod spec, or of
+// the first container when name is empty.
+//
+// Parameters:
+// - pod: The pod containing the container.
+// - name: The name of the container, or empty for the first container.
+//
+// Returns:
+// - The container image, or an empty string if not found.
+func containerImage(pod v1.Pod, name string) string {
+	for _, container := range pod.Spec.Containers {
+		if name == "" || container.Name == name {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// isFinishedPastTTL checks whether the given pod is in a terminal phase and the most
+// recent container termination happened longer ago than the specified TTL.
+//
+// Parameters:
+// - pod: The pod to check.
+// - ttl: The duration a terminal pod is kept after its last container finished.
+//
+// Returns:
+// - A boolean indicating whether the pod has outlived its TTL after finishing.
+func isFinishedPastTTL(pod v1.Pod, ttl time.Duration) bool {
+	if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+		return false
+	}
+	return finishedLongerAgo(pod, ttl)
+}
+
+// finishedLongerAgo checks whether the most recent container termination of the pod,
+// across restarts, happened longer ago than the specified duration. Pods without any
+// termination timestamp never qualify, since their age cannot be told.
+//
+// Parameters:
+// - pod: The pod to check.
+// - ttl: The duration that must have passed since the last container finished.
+//
+// Returns:
+// - A boolean indicating whether the pod's last container termination is older than ttl.
+func finishedLongerAgo(pod v1.Pod, ttl time.Duration) bool {
+	finishedAt, ok := latestFinishedAt(pod)
+	if !ok {
+		return false
+	}
+	return time.Since(finishedAt) > ttl
+}
+
+// latestFinishedAt returns the most recent termination timestamp across all init and
+// regular containers of the given pod, from both their current and last termination
+// state, so a container that crashed and restarted is measured from its latest death
+// rather than the pod start. A termination without FinishedAt falls back to StartedAt.
+//
+// Parameters:
+// - pod: The pod to inspect.
+//
+// Returns:
+// - The latest finish time and true, or the zero time and false if no container has finished.
+func latestFinishedAt(pod v1.Pod) (time.Time, bool) {
+	var latest time.Time
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, containerStatus := range statuses {
+		for _, terminated := range []*v1.ContainerStateTerminated{containerStatus.State.Terminated, containerStatus.LastTerminationState.Terminated} {
+			if terminated == nil {
+				continue
+			}
+			finishedAt := terminated.FinishedAt.Time
+			if finishedAt.IsZero() {
+				finishedAt = terminated.StartedAt.Time
+			}
+			if finishedAt.After(latest) {
+				latest = finishedAt
+			}
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// isOOMKilled checks whether the container's current state was terminated by the
+// kernel OOM killer.
+//
+// Parameters:
+// - containerStatus: The status of the container to check.
+//
+// Returns:
+// - A boolean indicating whether the container was OOMKilled.
+func isOOMKilled(containerStatus v1.ContainerStatus) bool {
+	return containerStatus.State.Terminated != nil && containerStatus.State.Terminated.Reason == "OOMKilled"
+}
+
+// matchingPodCondition finds the first condition of the pod matching one of the given
+// conditions by type and status, and by reason when one is configured.
+//
+// Parameters:
+// - pod: The pod to inspect.
+// - conditions: A slice of PodCondition to match against.
+//
+// Returns:
+// - The matching pod condition.
+// - A boolean indicating whether a matching condition was found.
+func matchingPodCondition(pod v1.Pod, conditions []config.PodCondition) (v1.PodCondition, bool) {
+	for _, condition := range pod.Status.Conditions {
+		for _, match := range conditions {
+			if string(condition.Type) == match.Type && string(condition.Status) == match.Status && (match.Reason == "" || condition.Reason == match.Reason) {
+				return condition, true
+			}
+		}
+	}
+	return v1.PodCondition{}, false
+}
+
+// podRequests returns the CPU and memory requested by the regular containers of the
+// pod, which pruning it would give back to the scheduler. Missing requests count as zero.
+//
+// Parameters:
+// - pod: The pod to inspect.
+//
+// Returns:
+// - The requested CPU in cores and memory in bytes.
+func podRequests(pod v1.Pod) (float64, float64) {
+	var cpu, memory float64
+	for _, container := range pod.Spec.Containers {
+		if request, exists := container.Resources.Requests[v1.ResourceCPU]; exists {
+			cpu += request.AsApproximateFloat64()
+		}
+		if request, exists := container.Resources.Requests[v1.ResourceMemory]; exists {
+			memory += request.AsApproximateFloat64()
+		}
+	}
+	return cpu, memory
+}
+
+// containerLimits returns the memory and CPU limits declared for the named container
+// in the pod spec, so an OOMKilled container can be reported with what it was allowed.
+//
+// Parameters:
+// - pod: The pod containing the container.
+// - name: The name of the container.
+//
+// Returns:
+// - The memory limit and CPU limit, each "unset" if not declared.
+func containerLimits(pod v1.Pod, name string) (string, string) {
+	memory, cpu := "unset", "unset"
+	for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.Name != name {
+			continue
+		}
+		if limit, exists := container.Resources.Limits[v1.ResourceMemory]; exists {
+			memory = limit.String()
+		}
+		if limit, exists := container.Resources.Limits[v1.ResourceCPU]; exists {
+			cpu = limit.String()
+		}
+		break
+	}
+	return memory, cpu
+}
+
 // isContainerInState checks if the given container status is in one of the specified states.
-// It returns true if the container is waiting or terminated with a reason that matches one of the statuses.
+// It matches if the container is waiting or terminated with a reason that matches one of
+// the statuses exactly, or one of the patterns. When useLastTermination is set, the reason
+// of the previous termination is considered too, catching running containers that crashed before.
+// When messages is set, the message of the same state must also contain one of them, so a
+// generic reason such as Error only matches specific failures.
 //
 // Parameters:
 // - containerStatus: The status of the container to check.
 // - statuses: A slice of strings representing the states to check against.
+// - patterns: A slice of compiled regular expressions to match reasons against.
+// - messages: A slice of substrings one of which the state message must contain, empty to match any message.
+// - useLastTermination: A boolean indicating whether to also match the last termination reason.
 //
 // Returns:
+// - The matching reason.
+// - The state the reason was read from: "waiting", "terminated" or "lastTermination".
+// - The message of that state, if any.
 // - A boolean indicating whether the container status matches one of the specified states.
-func isContainerInState(containerStatus v1.ContainerStatus, statuses []string) bool {
+func isContainerInState(containerStatus v1.ContainerStatus, statuses []string, patterns []*regexp.Regexp, messages []string, useLastTermination bool) (string, string, string, bool) {
 	statusSet := make(map[string]struct{}, len(statuses))
 	for _, status := range statuses {
 		statusSet[status] = struct{}{}
 	}
 
+	var states [][3]string
 	if containerStatus.State.Waiting != nil {
-		if _, exists := statusSet[containerStatus.State.Waiting.Reason]; exists {
+		states = append(states, [3]string{containerStatus.State.Waiting.Reason, "waiting", containerStatus.State.Waiting.Message})
+	}
+	if containerStatus.State.Terminated != nil {
+		states = append(states, [3]string{containerStatus.State.Terminated.Reason, "terminated", containerStatus.State.Terminated.Message})
+	}
+	if useLastTermination && containerStatus.LastTerminationState.Terminated != nil {
+		states = append(states, [3]string{containerStatus.LastTerminationState.Terminated.Reason, "lastTermination", containerStatus.LastTerminationState.Terminated.Message})
+	}
+	for _, state := range states {
+		reason, source, message := state[0], state[1], state[2]
+		if !matchesReason(reason, statusSet, patterns) || !containsAny(message, messages) {
+			continue
+		}
+		return reason, source, message, true
+	}
+	return "", "", "", false
+}
+
+// matchesReason checks whether the reason is one of the statuses or matches one of the patterns.
+//
+// Parameters:
+// - reason: The reason of a container state.
+// - statusSet: The set of reasons to match exactly.
+// - patterns: A slice of compiled regular expressions to match the reason against.
+//
+// Returns:
+// - A boolean indicating whether the reason matches.
+func matchesReason(reason string, statusSet map[string]struct{}, patterns []*regexp.Regexp) bool {
+	if _, exists := statusSet[reason]; exists {
+		return true
+	}
+	for _, pattern := range patterns {
+		if reason != "" && pattern.MatchString(reason) {
 			return true
 		}
 	}
-	if containerStatus.State.Terminated != nil {
-		if _, exists := statusSet[containerStatus.State.Terminated.Reason]; exists {
+	return false
+}
+
+// containsAny checks whether the message contains one of the substrings.
+//
+// Parameters:
+// - message: The message of a container state.
+// - substrings: The substrings to look for, empty to accept any message.
+//
+// Returns:
+// - A boolean indicating whether the message contains one of the substrings, or true if there are none.
+func containsAny(message string, substrings []string) bool {
+	if len(substrings) == 0 {
+		return true
+	}
+	for _, substring := range substrings {
+		if strings.Contains(message, substring) {
 			return true
 		}
 	}
@@ -115,33 +593,119 @@ func isContainerInState(containerStatus v1.ContainerStatus, statuses []string) b
 }
 
 // DeleteContainers deletes the specified containers (pods) in the given namespace.
-// It logs warnings for any containers that do not conform to the expected format.
+// Deletions run concurrently, bounded by the given DeleteLimiter, and throttled deletions are retried.
 // If a pod deletion fails, it logs an error; otherwise, it logs a success message.
 //
 // Parameters:
+// - ctx: The context bounding the API calls.
 // - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
 // - containers: A slice of ContainerInfo containing the names of the containers to delete.
+// - annotation: The annotation key recording why each pod was selected before it is deleted, empty to skip.
+// - finalizers: The finalizers that may be removed before deleting, empty to delete pods as they are.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
 // - log: A logger used to log messages regarding the deletion process.
-func DeleteContainers(clientset *kubernetes.Clientset, containers []ContainerInfo, log *logrus.Logger) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+//
+// Returns:
+// - The number of pods that were successfully deleted.
+func DeleteContainers(ctx context.Context, clientset kubernetes.Interface, containers []ContainerInfo, annotation string, finalizers []string, limiter *DeleteLimiter, log *logrus.Logger) int {
+	return deletePods(ctx, clientset, containers, annotation, finalizers, metav1.DeleteOptions{}, limiter, log)
+}
 
-	for _, container := range containers {
-		err := clientset.CoreV1().Pods(container.Namespace).Delete(ctx, container.PodName, metav1.DeleteOptions{})
-		if err != nil {
-			error := []string{
-				fmt.Sprintf("pod:%s", container.PodName),
-				fmt.Sprintf("namespace:%s", container.Namespace),
-				fmt.Sprintf("error:%v", err),
-			}
-			utils.LogWithFields(logrus.ErrorLevel, error, "Failed to delete pod", err)
-		} else {
-			message := []string{
-				fmt.Sprintf("pod:%s", container.PodName),
-				fmt.Sprintf("namespace:%s", container.Namespace),
+// ForceDeletePods deletes the specified pods immediately, with a grace period of 0, for
+// pods whose kubelet is gone and will never confirm a graceful termination.
+// Deletions run concurrently, bounded by the given DeleteLimiter, and throttled deletions are retried.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - pods: A slice of ContainerInfo describing the pods to delete.
+// - annotation: The annotation key recording why each pod was selected before it is deleted, empty to skip.
+// - finalizers: The finalizers that may be removed before deleting, empty to delete pods as they are.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - log: A logger used to log messages regarding the deletion process.
+//
+// Returns:
+// - The number of pods that were successfully deleted.
+func ForceDeletePods(ctx context.Context, clientset kubernetes.Interface, pods []ContainerInfo, annotation string, finalizers []string, limiter *DeleteLimiter, log *logrus.Logger) int {
+	gracePeriod := int64(0)
+	return deletePods(ctx, clientset, pods, annotation, finalizers, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}, limiter, log)
+}
+
+// deletePods deletes the specified pods with the given delete options, shared by
+// DeleteContainers and ForceDeletePods. Entries for the same pod are grouped, so the
+// pod is deleted once and every matching container is counted and recorded.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - containers: A slice of ContainerInfo describing the pods to delete.
+// - annotation: The annotation key recording why each pod was selected before it is deleted, empty to skip.
+// - finalizers: The finalizers that may be removed before deleting, empty to delete pods as they are.
+// - options: The options of every delete call.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - log: A logger used to log messages regarding the deletion process.
+//
+// Returns:
+// - The number of pods that were successfully deleted.
+func deletePods(ctx context.Context, clientset kubernetes.Interface, containers []ContainerInfo, annotation string, finalizers []string, options metav1.DeleteOptions, limiter *DeleteLimiter, log *logrus.Logger) int {
+	// Delete each pod once, however many of its containers matched.
+	groups := GroupByPod(containers)
+	deletions := make([]deletion, 0, len(groups))
+	for _, pod := range groups {
+		container := pod.Matches[0]
+		fields := []string{fmt.Sprintf("pod:%s", container.PodName), fmt.Sprintf("namespace:%s", container.Namespace)}
+		details := []string{fmt.Sprintf("matches:%s", pod)}
+		for _, match := range pod.Matches {
+			if match.MemoryLimit != "" {
+				details = append(details,
+					fmt.Sprintf("container:%s", match.ContainerName),
+					fmt.Sprintf("memoryLimit:%s", match.MemoryLimit),
+					fmt.Sprintf("cpuLimit:%s", match.CPULimit),
+				)
 			}
-			metrics.ContainersPruned.WithLabelValues(container.Namespace, container.Status).Add(1) // Increment the counter
-			utils.LogWithFields(logrus.InfoLevel, message, "Successfully deleted pod")
 		}
+		deletions = append(deletions, deletion{
+			kind:      "pod",
+			namespace: container.Namespace,
+			fields:    fields,
+			details:   details,
+			items:     pod.Matches,
+			prepare: func(ctx context.Context) bool {
+				// Leave an audit trail on the pod itself for anyone inspecting it before it is gone.
+				if annotation != "" {
+					if err := annotatePod(ctx, clientset, container.Namespace, container.PodName, map[string]string{annotation: selectionReason(container)}); err != nil {
+						utils.LogWithFieldsContext(ctx, logrus.WarnLevel, fields, "Failed to annotate pod with selection reason", err)
+					}
+				}
+				// Only strip finalizers pod-pruner was told about; leave pods held by any other alone.
+				if len(finalizers) == 0 {
+					return true
+				}
+				unlisted, err := stripFinalizers(ctx, clientset, container.Namespace, container.PodName, finalizers)
+				if err != nil {
+					countError(ctx)
+					utils.LogWithFieldsContext(ctx, logrus.ErrorLevel, fields, "Failed to remove pod finalizers, skipping pod deletion", err)
+					return false
+				}
+				if len(unlisted) > 0 {
+					utils.LogWithFieldsContext(ctx, logrus.WarnLevel, append(fields, fmt.Sprintf("finalizers:%s", strings.Join(unlisted, ","))), "Skipping pod deletion, pod has finalizers not in FINALIZER_ALLOWLIST")
+					return false
+				}
+				return true
+			},
+			delete: func(ctx context.Context) error {
+				return clientset.CoreV1().Pods(container.Namespace).Delete(ctx, container.PodName, options)
+			},
+			get: func(ctx context.Context) (metav1.Object, error) {
+				return clientset.CoreV1().Pods(container.Namespace).Get(ctx, container.PodName, metav1.GetOptions{})
+			},
+			pruned: func() {
+				for _, match := range pod.Matches {
+					metrics.ContainersPruned.WithLabelValues(match.Namespace, metrics.StateLabel(match.Status)).Add(1) // Increment the counter
+					report.RecordDeletion("pod", match)
+				}
+			},
+		})
 	}
+	return deleteResources(ctx, limiter, deletions)
 }
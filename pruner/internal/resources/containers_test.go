@@ -0,0 +1,393 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// waitingPod builds a pod whose single container is waiting with the given reason.
+func waitingPod(name, reason string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "app",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}},
+		}}},
+	}
+}
+
+func TestGetContainersPagination(t *testing.T) {
+	pages := map[string]*v1.PodList{
+		"": {
+			ListMeta: metav1.ListMeta{Continue: "page-2"},
+			Items:    []v1.Pod{waitingPod("a", "CrashLoopBackOff"), waitingPod("b", "CrashLoopBackOff"), waitingPod("healthy", "ContainerCreating")},
+		},
+		"page-2": {
+			Items: []v1.Pod{waitingPod("c", "CrashLoopBackOff"), waitingPod("d", "CrashLoopBackOff")},
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	var calls []string
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		token := action.(k8stesting.ListActionImpl).ListOptions.Continue
+		calls = append(calls, token)
+		page, ok := pages[token]
+		if !ok {
+			return true, nil, fmt.Errorf("unexpected continue token '%s'", token)
+		}
+		return true, page, nil
+	})
+
+	containers, err := GetContainers(context.Background(), clientset, "default", config.Config{ContainerStatuses: []string{"CrashLoopBackOff"}})
+	if err != nil {
+		t.Fatalf("GetContainers() error = %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "" || calls[1] != "page-2" {
+		t.Errorf("list calls = %q, want [\"\" \"page-2\"]", calls)
+	}
+	seen := make(map[string]int)
+	for _, container := range containers {
+		seen[container.PodName]++
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if seen[name] != 1 {
+			t.Errorf("pod %s returned %d times, want exactly once", name, seen[name])
+		}
+	}
+	if len(containers) != 4 {
+		t.Errorf("GetContainers() returned %d containers, want 4", len(containers))
+	}
+}
+
+// terminatedStatus builds the status of a container that finished the given duration ago.
+func terminatedStatus(name string, finishedAgo time.Duration) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name: name,
+		State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			Reason:     "Completed",
+			FinishedAt: metav1.NewTime(time.Now().Add(-finishedAgo)),
+		}},
+	}
+}
+
+func TestIsFinishedPastTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		phase    v1.PodPhase
+		init     []v1.ContainerStatus
+		statuses []v1.ContainerStatus
+		want     bool
+	}{
+		{
+			name:     "all containers finished past the TTL",
+			phase:    v1.PodSucceeded,
+			statuses: []v1.ContainerStatus{terminatedStatus("app", 3*time.Hour), terminatedStatus("sidecar", 2*time.Hour)},
+			want:     true,
+		},
+		{
+			name:     "latest container finished within the TTL",
+			phase:    v1.PodFailed,
+			statuses: []v1.ContainerStatus{terminatedStatus("app", 3*time.Hour), terminatedStatus("sidecar", 10*time.Minute)},
+			want:     false,
+		},
+		{
+			name:     "init container finished within the TTL",
+			phase:    v1.PodSucceeded,
+			init:     []v1.ContainerStatus{terminatedStatus("setup", 5*time.Minute)},
+			statuses: []v1.ContainerStatus{terminatedStatus("app", 3*time.Hour)},
+			want:     false,
+		},
+		{
+			name:     "pod not in a terminal phase",
+			phase:    v1.PodRunning,
+			statuses: []v1.ContainerStatus{terminatedStatus("app", 3*time.Hour)},
+			want:     false,
+		},
+		{
+			name:  "no container finished",
+			phase: v1.PodFailed,
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := v1.Pod{Status: v1.PodStatus{Phase: tt.phase, InitContainerStatuses: tt.init, ContainerStatuses: tt.statuses}}
+			if got := isFinishedPastTTL(pod, time.Hour); got != tt.want {
+				t.Errorf("isFinishedPastTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestFinishedAt(t *testing.T) {
+	early := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	late := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	pod := v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+		{Name: "app", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(early)}}},
+		// A restarted container is measured from its last termination.
+		{Name: "sidecar", LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(late)}}},
+	}}}
+
+	got, ok := latestFinishedAt(pod)
+	if !ok || !got.Equal(late) {
+		t.Errorf("latestFinishedAt() = %v, %v, want %v, true", got, ok, late)
+	}
+}
+
+func TestIsContainerInStatePatterns(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^CNI.*Failed$`), regexp.MustCompile(`Exit[0-9]*`)}
+	tests := []struct {
+		name       string
+		status     v1.ContainerStatus
+		wantReason string
+		wantSource string
+		wantMatch  bool
+	}{
+		{
+			name:       "waiting reason matches a pattern",
+			status:     v1.ContainerStatus{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CNISetupFailed"}}},
+			wantReason: "CNISetupFailed",
+			wantSource: "waiting",
+			wantMatch:  true,
+		},
+		{
+			name:       "terminated reason matches a pattern",
+			status:     v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Exit137"}}},
+			wantReason: "Exit137",
+			wantSource: "terminated",
+			wantMatch:  true,
+		},
+		{
+			name:       "exact reason still matches",
+			status:     v1.ContainerStatus{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			wantReason: "CrashLoopBackOff",
+			wantSource: "waiting",
+			wantMatch:  true,
+		},
+		{
+			name:   "pattern is anchored",
+			status: v1.ContainerStatus{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CNISetupFailedAgain"}}},
+		},
+		{
+			name:   "empty reason never matches, even a pattern matching the empty string",
+			status: v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, source, _, matched := isContainerInState(tt.status, []string{"CrashLoopBackOff"}, patterns, nil, false)
+			if reason != tt.wantReason || source != tt.wantSource || matched != tt.wantMatch {
+				t.Errorf("isContainerInState() = %q, %q, %v, want %q, %q, %v", reason, source, matched, tt.wantReason, tt.wantSource, tt.wantMatch)
+			}
+		})
+	}
+}
+
+// multiContainerPod builds a pod with one container per entry, waiting with the
+// given reason, or running when the reason is empty.
+func multiContainerPod(name string, reasons ...string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	for i, reason := range reasons {
+		state := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+		if reason != "" {
+			state = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}
+		}
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{Name: fmt.Sprintf("c%d", i), State: state})
+	}
+	return pod
+}
+
+// selectedPods lists the pods of the default namespace GetContainers selects with cfg,
+// along with the number of containers selected in each.
+func selectedPods(t *testing.T, cfg config.Config, pods ...runtime.Object) map[string]int {
+	t.Helper()
+	containers, err := GetContainers(context.Background(), fake.NewSimpleClientset(pods...), "default", cfg)
+	if err != nil {
+		t.Fatalf("GetContainers() error = %v", err)
+	}
+	selected := make(map[string]int)
+	for _, container := range containers {
+		selected[container.PodName]++
+	}
+	return selected
+}
+
+func TestGetContainersStatusMatchAll(t *testing.T) {
+	pods := []runtime.Object{
+		multiContainerPod("all-crashed", "CrashLoopBackOff", "CrashLoopBackOff"),
+		multiContainerPod("mixed-running", "CrashLoopBackOff", ""),
+		multiContainerPod("mixed-reasons", "CrashLoopBackOff", "ContainerCreating"),
+		multiContainerPod("healthy", "", ""),
+	}
+	tests := []struct {
+		name     string
+		matchAll bool
+		want     map[string]int
+	}{
+		{
+			name: "any container matching selects the pod",
+			want: map[string]int{"all-crashed": 2, "mixed-running": 1, "mixed-reasons": 1},
+		},
+		{
+			name:     "all containers must match with STATUS_MATCH_ALL",
+			matchAll: true,
+			want:     map[string]int{"all-crashed": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{ContainerStatuses: []string{"CrashLoopBackOff"}, StatusMatchAll: tt.matchAll}
+			if got := selectedPods(t, cfg, pods...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected pods = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetContainersPredicatesCombinedWithAnd(t *testing.T) {
+	pod := func(name, tier, reason string, age time.Duration) runtime.Object {
+		pod := multiContainerPod(name, reason)
+		pod.Labels = map[string]string{"tier": tier}
+		pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		return pod
+	}
+	pods := []runtime.Object{
+		pod("matches-all", "batch", "CrashLoopBackOff", 2*time.Hour),
+		pod("wrong-label", "web", "CrashLoopBackOff", 2*time.Hour),
+		pod("wrong-state", "batch", "ContainerCreating", 2*time.Hour),
+		pod("too-young", "batch", "CrashLoopBackOff", time.Minute),
+	}
+	cfg := config.Config{
+		ContainerStatuses: []string{"CrashLoopBackOff"},
+		PodLabelSelector:  labels.SelectorFromSet(labels.Set{"tier": "batch"}),
+		PodMinAge:         time.Hour,
+	}
+
+	want := map[string]int{"matches-all": 1}
+	if got := selectedPods(t, cfg, pods...); !reflect.DeepEqual(got, want) {
+		t.Errorf("selected pods = %v, want %v", got, want)
+	}
+}
+
+func TestGetContainersSkipIfAnyRunning(t *testing.T) {
+	pods := []runtime.Object{
+		multiContainerPod("crashed-next-to-running", "CrashLoopBackOff", ""),
+		multiContainerPod("all-crashed", "CrashLoopBackOff", "CrashLoopBackOff"),
+		multiContainerPod("crashed-next-to-creating", "CrashLoopBackOff", "ContainerCreating"),
+	}
+	tests := []struct {
+		name             string
+		skipIfAnyRunning bool
+		want             map[string]int
+	}{
+		{
+			name: "disabled selects every crashed container",
+			want: map[string]int{"crashed-next-to-running": 1, "all-crashed": 2, "crashed-next-to-creating": 1},
+		},
+		{
+			name:             "enabled leaves partially running pods alone",
+			skipIfAnyRunning: true,
+			want:             map[string]int{"all-crashed": 2, "crashed-next-to-creating": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{ContainerStatuses: []string{"CrashLoopBackOff"}, SkipIfAnyRunning: tt.skipIfAnyRunning}
+			if got := selectedPods(t, cfg, pods...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected pods = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetContainersPodConditions(t *testing.T) {
+	unschedulable := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "unschedulable", Namespace: "default"},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			Conditions: []v1.PodCondition{{
+				Type:    v1.PodScheduled,
+				Status:  v1.ConditionFalse,
+				Reason:  v1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available",
+			}},
+		},
+	}
+	scheduled := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "scheduled", Namespace: "default"},
+		Status: v1.PodStatus{
+			Phase:      v1.PodPending,
+			Conditions: []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionTrue}},
+		},
+	}
+	cfg := config.Config{PodConditions: []config.PodCondition{{Type: "PodScheduled", Status: "False", Reason: "Unschedulable"}}}
+
+	containers, err := GetContainers(context.Background(), fake.NewSimpleClientset(unschedulable, scheduled), "default", cfg)
+	if err != nil {
+		t.Fatalf("GetContainers() error = %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("GetContainers() returned %d containers, want 1", len(containers))
+	}
+	got := containers[0]
+	if got.PodName != "unschedulable" || got.Status != "Unschedulable" || got.Condition != "PodScheduled=False:Unschedulable" || got.Message != "0/3 nodes are available" || got.Rule != "POD_CONDITIONS" {
+		t.Errorf("GetContainers() = %+v, want the unschedulable pod selected by POD_CONDITIONS", got)
+	}
+}
+
+func TestMatchingPodCondition(t *testing.T) {
+	unschedulable := v1.PodCondition{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}
+	tests := []struct {
+		name       string
+		conditions []config.PodCondition
+		want       bool
+	}{
+		{name: "type, status and reason match", conditions: []config.PodCondition{{Type: "PodScheduled", Status: "False", Reason: "Unschedulable"}}, want: true},
+		{name: "empty reason matches any reason", conditions: []config.PodCondition{{Type: "PodScheduled", Status: "False"}}, want: true},
+		{name: "status differs", conditions: []config.PodCondition{{Type: "PodScheduled", Status: "True"}}},
+		{name: "reason differs", conditions: []config.PodCondition{{Type: "PodScheduled", Status: "False", Reason: "SchedulingGated"}}},
+		{name: "type differs", conditions: []config.PodCondition{{Type: "Ready", Status: "False"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := v1.Pod{Status: v1.PodStatus{Conditions: []v1.PodCondition{unschedulable}}}
+			if _, got := matchingPodCondition(pod, tt.conditions); got != tt.want {
+				t.Errorf("matchingPodCondition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
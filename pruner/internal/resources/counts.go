@@ -0,0 +1,106 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// stepCountsKey is the context key StepCounts are carried under.
+type stepCountsKey struct{}
+
+// StepCounts accumulates how many resources a single resource type scanned in a
+// namespace, which of them were deleted and how many of its API calls failed. It is
+// carried in the context, so the listing and delete functions can record to it
+// without changing their results.
+type StepCounts struct {
+	scanned atomic.Int64
+	errors  atomic.Int64
+	mu      sync.Mutex
+	deleted []ContainerInfo
+}
+
+// WithStepCounts returns a copy of ctx that the listing and delete functions record to.
+//
+// Parameters:
+// - ctx: The parent context.
+// - counts: The StepCounts to record to.
+//
+// Returns:
+// - A context carrying counts.
+func WithStepCounts(ctx context.Context, counts *StepCounts) context.Context {
+	return context.WithValue(ctx, stepCountsKey{}, counts)
+}
+
+// Scanned returns the number of resources listed.
+func (c *StepCounts) Scanned() int {
+	return int(c.scanned.Load())
+}
+
+// Errors returns the number of failed API calls.
+func (c *StepCounts) Errors() int {
+	return int(c.errors.Load())
+}
+
+// Deleted returns the candidates whose deletion was confirmed.
+func (c *StepCounts) Deleted() []ContainerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ContainerInfo(nil), c.deleted...)
+}
+
+// AddError records a failed API call, such as a listing that exhausted its retries.
+func (c *StepCounts) AddError() {
+	c.errors.Add(1)
+}
+
+// countScanned records the number of resources a successful listing scanned. It is
+// only called once the whole listing succeeded, so retried attempts are not counted.
+//
+// Parameters:
+// - ctx: The context, carrying StepCounts when counts are collected.
+// - scanned: The number of resources listed.
+func countScanned(ctx context.Context, scanned int) {
+	if counts, ok := ctx.Value(stepCountsKey{}).(*StepCounts); ok {
+		counts.scanned.Add(int64(scanned))
+	}
+}
+
+// countError records a failed delete or patch call.
+//
+// Parameters:
+// - ctx: The context, carrying StepCounts when counts are collected.
+func countError(ctx context.Context) {
+	if counts, ok := ctx.Value(stepCountsKey{}).(*StepCounts); ok {
+		counts.AddError()
+	}
+}
+
+// countDeleted records the candidates covered by a confirmed deletion.
+//
+// Parameters:
+// - ctx: The context, carrying StepCounts when counts are collected.
+// - items: The candidates that were deleted.
+func countDeleted(ctx context.Context, items []ContainerInfo) {
+	if counts, ok := ctx.Value(stepCountsKey{}).(*StepCounts); ok {
+		counts.mu.Lock()
+		counts.deleted = append(counts.deleted, items...)
+		counts.mu.Unlock()
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// crashLoopBackOff is the waiting reason the kubelet reports for a container that
+// keeps crashing and is being restarted with an exponential back-off.
+const crashLoopBackOff = "CrashLoopBackOff"
+
+// highRestartRate is the status reported for containers selected by MAX_RESTART_RATE.
+const highRestartRate = "HighRestartRate"
+
+// isCrashLooping checks whether the container is currently waiting in
+// CrashLoopBackOff after at least one restart.
+//
+// Parameters:
+// - containerStatus: The status of the container to check.
+//
+// Returns:
+// - A boolean indicating whether the container is crash looping.
+func isCrashLooping(containerStatus v1.ContainerStatus) bool {
+	return containerStatus.State.Waiting != nil &&
+		containerStatus.State.Waiting.Reason == crashLoopBackOff &&
+		containerStatus.RestartCount > 0
+}
+
+// crashLoopDuration estimates how long a container has been crash looping.
+//
+// Kubernetes does not record when a container entered CrashLoopBackOff, so this
+// is a heuristic. The pod's ContainersReady condition only transitions when the
+// containers go from ready to not ready (or the reverse), so while a container
+// keeps crashing its LastTransitionTime marks the moment the pod stopped being
+// healthy. When that condition is missing, the pod start time is used instead.
+// The estimate is then bounded below by the minimum time the kubelet back-off
+// needs to reach the observed restart count (10s doubling up to 5m per restart),
+// so a pod with many restarts is never reported as having just started looping.
+//
+// Parameters:
+// - pod: The pod containing the container.
+// - containerStatus: The status of the crash looping container.
+//
+// Returns:
+// - The estimated time the container has spent crash looping.
+func crashLoopDuration(pod v1.Pod, containerStatus v1.ContainerStatus) time.Duration {
+	var since time.Time
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.ContainersReady && condition.Status == v1.ConditionFalse {
+			since = condition.LastTransitionTime.Time
+		}
+	}
+	if since.IsZero() && pod.Status.StartTime != nil {
+		since = pod.Status.StartTime.Time
+	}
+
+	var observed time.Duration
+	if !since.IsZero() {
+		observed = time.Since(since)
+	}
+	return max(observed, minimumBackOff(containerStatus.RestartCount))
+}
+
+// minimumBackOff returns the minimum cumulative kubelet back-off for the given
+// number of restarts, starting at 10 seconds and doubling up to 5 minutes.
+//
+// Parameters:
+// - restarts: The number of container restarts.
+//
+// Returns:
+// - The minimum time needed to accumulate that many restarts.
+func minimumBackOff(restarts int32) time.Duration {
+	var total time.Duration
+	delay := 10 * time.Second
+	for i := int32(0); i < restarts; i++ {
+		total += delay
+		delay = min(delay*2, 5*time.Minute)
+	}
+	return total
+}
+
+// minRestartsForRate is the number of restarts a container needs before its restart
+// rate is considered, so a single early restart of a young pod is not mistaken for flapping.
+const minRestartsForRate = 3
+
+// restartRate computes how often a container restarts, in restarts per hour, as its
+// RestartCount divided by the time since the pod started (or was created, if it has
+// not started). A pod that crashed a lot long ago and has since stabilised therefore
+// sees its rate decay over time, while a genuinely flapping pod keeps a high rate.
+//
+// Parameters:
+// - pod: The pod containing the container.
+// - containerStatus: The status of the container.
+//
+// Returns:
+// - The restart rate in restarts per hour.
+// - A boolean indicating whether the container restarted often enough for the rate to be meaningful.
+func restartRate(pod v1.Pod, containerStatus v1.ContainerStatus) (float64, bool) {
+	if containerStatus.RestartCount < minRestartsForRate {
+		return 0, false
+	}
+	since := pod.CreationTimestamp.Time
+	if pod.Status.StartTime != nil {
+		since = pod.Status.StartTime.Time
+	}
+	elapsed := time.Since(since)
+	if since.IsZero() || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(containerStatus.RestartCount) / elapsed.Hours(), true
+}
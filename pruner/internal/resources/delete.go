@@ -0,0 +1,118 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteCallTimeout bounds every API call made to delete an object. It applies to each
+// call rather than to the whole batch, so time spent waiting for a delete slot, the
+// deletion rate limit or a retry does not eat into the calls of later objects.
+const deleteCallTimeout = 30 * time.Second
+
+// deletion describes a single object deleteResources deletes, with the calls and
+// bookkeeping specific to its kind.
+type deletion struct {
+	kind      string                                           // kind is the kind of the object, for logs and metrics (e.g., pod, job).
+	namespace string                                           // namespace is the namespace of the object.
+	fields    []string                                         // fields identify the object in every log entry.
+	details   []string                                         // details are added to the fields when the deletion succeeds.
+	prepare   func(ctx context.Context) bool                   // prepare runs before the delete call and returns false to skip it, nil to always delete.
+	delete    func(ctx context.Context) error                  // delete makes the delete call.
+	get       func(ctx context.Context) (metav1.Object, error) // get fetches the object by name, to confirm it is gone with VERIFY_DELETION.
+	pruned    func()                                           // pruned records the confirmed deletion in the metrics and the audit trail.
+	items     []ContainerInfo                                  // items are the candidates the deletion covers, recorded as deleted once it is confirmed.
+}
+
+// deleteResources deletes the given objects concurrently, bounded by the limiter, and
+// handles NAMESPACE_HOURLY_BUDGET, retries of throttled deletes, VERIFY_DELETION and
+// logging the same way for every kind. An object that is skipped or fails to be
+// deleted gives its budget back, unless the deletion was made but not confirmed.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - deletions: A slice of deletion, one per object to delete.
+//
+// Returns:
+// - The number of objects that were successfully deleted.
+func deleteResources(ctx context.Context, limiter *DeleteLimiter, deletions []deletion) int {
+	var wg sync.WaitGroup
+	var deleted atomic.Int64
+	for _, d := range deletions {
+		wg.Add(1)
+		go func(d deletion) {
+			defer wg.Done()
+			if err := limiter.Acquire(ctx, d.namespace); err != nil {
+				utils.LogWithFieldsContext(ctx, logrus.WarnLevel, d.fields, fmt.Sprintf("Skipping %s deletion, no delete slot before the context was done", d.kind), err)
+				return
+			}
+			defer limiter.Release(d.namespace)
+
+			if !limiter.Reserve(d.namespace) {
+				utils.LogWithFieldsContext(ctx, logrus.WarnLevel, d.fields, fmt.Sprintf("Skipping %s deletion, NAMESPACE_HOURLY_BUDGET exhausted", d.kind))
+				return
+			}
+			if d.prepare != nil && !withCallTimeout(ctx, d.prepare) {
+				limiter.Refund(d.namespace)
+				return
+			}
+
+			if err := limiter.Retry(ctx, func() error { return withCallTimeout(ctx, d.delete) }); err != nil {
+				limiter.Refund(d.namespace)
+				countError(ctx)
+				utils.LogWithFieldsContext(ctx, logrus.ErrorLevel, d.fields, fmt.Sprintf("Failed to delete %s", d.kind), err)
+			} else if err := limiter.Confirm(ctx, func(ctx context.Context) bool {
+				return withCallTimeout(ctx, func(ctx context.Context) bool { return isGone(d.get(ctx)) })
+			}); err != nil {
+				metrics.DeletionsUnconfirmed.WithLabelValues(d.namespace, d.kind).Inc()
+				utils.LogWithFieldsContext(ctx, logrus.WarnLevel, d.fields, fmt.Sprintf("Deletion of %s not confirmed within VERIFY_DELETION_TIMEOUT, not counting it as pruned", d.kind), err)
+			} else {
+				d.pruned()
+				countDeleted(ctx, d.items)
+				utils.LogWithFieldsContext(ctx, logrus.InfoLevel, append(d.fields, d.details...), fmt.Sprintf("Successfully deleted %s", d.kind))
+				deleted.Add(1)
+			}
+		}(d)
+	}
+	wg.Wait()
+	return int(deleted.Load())
+}
+
+// withCallTimeout runs a single step of a deletion with its own deleteCallTimeout.
+//
+// Parameters:
+// - ctx: The context the timeout is derived from.
+// - call: The step to run.
+//
+// Returns:
+// - The result of call.
+func withCallTimeout[T any](ctx context.Context, call func(ctx context.Context) T) T {
+	ctx, cancel := context.WithTimeout(ctx, deleteCallTimeout)
+	defer cancel()
+	return call(ctx)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serviceEndpoints looks up the pods currently in rotation behind a Service, listing
+// the EndpointSlices of a namespace at most once. It is scoped to a single listing so
+// membership never goes stale.
+type serviceEndpoints struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	once      sync.Once
+	pods      map[string]struct{}
+	err       error
+}
+
+// newServiceEndpoints creates a new, empty serviceEndpoints.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+//
+// Returns:
+// - A pointer to a new instance of serviceEndpoints.
+func newServiceEndpoints(ctx context.Context, clientset kubernetes.Interface) *serviceEndpoints {
+	return &serviceEndpoints{ctx: ctx, clientset: clientset}
+}
+
+// contains checks whether the pod is a ready endpoint of any Service in its namespace,
+// so deleting it could fail requests still routed to it.
+//
+// Parameters:
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether the pod is a ready Service endpoint.
+// - An error if the EndpointSlices could not be listed.
+func (e *serviceEndpoints) contains(pod v1.Pod) (bool, error) {
+	e.once.Do(func() {
+		e.pods, e.err = e.list(pod.Namespace)
+	})
+	if e.err != nil {
+		return false, e.err
+	}
+	_, exists := e.pods[pod.Name]
+	return exists, nil
+}
+
+// list returns the names of the pods that are ready endpoints in the EndpointSlices
+// of Services in the namespace. An endpoint without a ready condition is ready, as
+// the EndpointSlice API defines.
+//
+// Parameters:
+// - namespace: The namespace to list EndpointSlices in.
+//
+// Returns:
+// - A set of pod names.
+// - An error if the EndpointSlices could not be listed.
+func (e *serviceEndpoints) list(namespace string) (map[string]struct{}, error) {
+	pods := make(map[string]struct{})
+	var continueToken string
+	for {
+		sliceList, err := e.clientset.DiscoveryV1().EndpointSlices(namespace).List(e.ctx, metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName,
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list endpointslices in namespace '%s': %w", namespace, err)
+		}
+		for _, slice := range sliceList.Items {
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+					continue
+				}
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					pods[endpoint.TargetRef.Name] = struct{}{}
+				}
+			}
+		}
+		if sliceList.Continue == "" {
+			return pods, nil
+		}
+		continueToken = sliceList.Continue
+	}
+}
+
+// isServiceEndpoint checks whether the pod must be left alone under SKIP_SERVICE_ENDPOINTS,
+// either because it is a ready Service endpoint or because that could not be checked.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - endpoints: The serviceEndpoints of the current listing.
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether the pod must be skipped.
+func isServiceEndpoint(ctx context.Context, endpoints *serviceEndpoints, pod v1.Pod) bool {
+	fields := []string{fmt.Sprintf("pod:%s", pod.Name), fmt.Sprintf("namespace:%s", pod.Namespace)}
+	inRotation, err := endpoints.contains(pod)
+	if err != nil {
+		utils.LogWithFieldsContext(ctx, logrus.WarnLevel, fields, "Skipping pod, could not check Service endpoints", err)
+		return true
+	}
+	if inRotation {
+		utils.LogWithFieldsContext(ctx, logrus.DebugLevel, fields, "Skipping pod, still a ready Service endpoint under SKIP_SERVICE_ENDPOINTS")
+	}
+	return inRotation
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// stripFinalizers removes the finalizers listed in allowlist from the pod, so its
+// deletion is not held up by them. Finalizers pod-pruner does not know about are
+// never removed: if the pod carries any, it is left untouched and they are returned
+// so the deletion can be skipped. The patch only applies if the finalizers have not
+// changed since the pod was read.
+//
+// Parameters:
+// - ctx: The context used to cancel the requests.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace of the pod.
+// - name: The name of the pod.
+// - allowlist: The finalizers that may be removed (FINALIZER_ALLOWLIST).
+//
+// Returns:
+// - The finalizers of the pod that are not in the allowlist, empty if it may be deleted.
+// - An error if the pod could not be read or patched.
+func stripFinalizers(ctx context.Context, clientset kubernetes.Interface, namespace, name string, allowlist []string) ([]string, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod '%s/%s': %w", namespace, name, err)
+	}
+	if len(pod.Finalizers) == 0 {
+		return nil, nil
+	}
+
+	var unlisted []string
+	for _, finalizer := range pod.Finalizers {
+		if !utils.Contains(allowlist, finalizer) {
+			unlisted = append(unlisted, finalizer)
+		}
+	}
+	if len(unlisted) > 0 {
+		return unlisted, nil
+	}
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/finalizers", "value": pod.Finalizers},
+		{"op": "remove", "path": "/metadata/finalizers"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode finalizer patch: %w", err)
+	}
+	if _, err := clientset.CoreV1().Pods(namespace).Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to remove finalizers of pod '%s/%s': %w", namespace, name, err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	v1 "k8s.io/api/core/v1"
+)
+
+// imagePullReasons are the waiting reasons the kubelet reports for a container whose
+// image cannot be pulled.
+var imagePullReasons = []string{"ErrImagePull", "ImagePullBackOff"}
+
+// isPullFailing checks whether the container is waiting because its image cannot be pulled.
+//
+// Parameters:
+// - containerStatus: The status of the container to check.
+//
+// Returns:
+// - A boolean indicating whether the image pull is failing.
+func isPullFailing(containerStatus v1.ContainerStatus) bool {
+	return containerStatus.State.Waiting != nil && utils.Contains(imagePullReasons, containerStatus.State.Waiting.Reason)
+}
+
+// pullFailureAge returns how long the pod has been failing to pull the image. The
+// kubelet does not record when pulling started failing, so the time since the pod
+// was scheduled is used, falling back to its creation time.
+//
+// Parameters:
+// - pod: The pod containing the container.
+//
+// Returns:
+// - The time the pod has spent trying to pull its images.
+func pullFailureAge(pod v1.Pod) time.Duration {
+	since := pod.CreationTimestamp.Time
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionTrue {
+			since = condition.LastTransitionTime.Time
+		}
+	}
+	return time.Since(since)
+}
@@ -19,71 +19,140 @@ package resources
 import (
 	"context"
 	"fmt"
-	"strings"
-	"sync"
+	"time"
 
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
 	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/report"
 	"github.com/saidsef/pod-pruner/pruner/utils"
 	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-// GetJobs retrieves a list of jobs from the specified namespace that match the statuses defined in the JOB_STATUSES environment variable.
+// jobMaxAgeExceeded is the status reported for jobs selected by JOB_MAX_AGE.
+const jobMaxAgeExceeded = "MaxAgeExceeded"
+
+// GetJobs retrieves a list of jobs from the specified namespace that match the condition types defined in JOB_STATUSES.
+// When JOB_TTL is set, a job is only selected once the matching condition has been present for longer than the TTL.
+// When JOB_MAX_AGE is set, jobs created longer ago than that are selected as well, whatever their conditions,
+// so stuck jobs that never complete or fail are cleaned up.
 // It returns a slice of job descriptions and an error if any occurs.
 //
 // Parameters:
+// - ctx: The context bounding the API calls.
 // - clientset: A Kubernetes clientset to interact with the Kubernetes API.
 // - namespace: The namespace from which to retrieve the jobs.
-// - log: A logger to log messages.
+// - cfg: The pruner configuration.
 //
 // Returns:
 // - A slice of ContainerInfo, each representing a job description with namespace, pod name, and status.
 // - An error if any occurs during the retrieval of jobs.
-func GetJobs(clientset *kubernetes.Clientset, namespace string, log *logrus.Logger) ([]ContainerInfo, error) {
-	statuses := strings.Split(strings.TrimSpace(utils.GetEnv("JOB_STATUSES", "Complete", log)), ",")
-	jobs, err := clientset.BatchV1().Jobs(namespace).List(context.Background(), metav1.ListOptions{})
+func GetJobs(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector(cfg.JobLabelSelector)})
 	if err != nil {
-		utils.LogWithFields(logrus.ErrorLevel, []string{}, "Error retrieving jobs", err)
+		utils.LogWithFieldsContext(ctx, logrus.ErrorLevel, []string{}, "Error retrieving jobs", err)
 		return nil, err
 	}
 
 	var jobsList []ContainerInfo
 	for _, job := range jobs.Items {
-		for _, jobStatus := range job.Status.Conditions {
-			if utils.Contains(statuses, string(jobStatus.Type)) {
-				jobsList = append(jobsList, ContainerInfo{
-					Namespace: job.Namespace,
-					PodName:   job.Name,
-					Status:    string(jobStatus.Type),
-				})
-			}
+		if isProtected(ctx, job.ObjectMeta, "job", cfg.ProtectAnnotation) {
+			continue
+		}
+		if status, remaining, matched := matchingJobCondition(job, cfg.JobStatuses, cfg.JobTTL); matched && remaining <= 0 {
+			jobsList = append(jobsList, jobInfo(job, status, "JOB_STATUSES"))
+			continue
+		}
+		if age := time.Since(job.CreationTimestamp.Time); cfg.JobMaxAge > 0 && age > cfg.JobMaxAge {
+			info := jobInfo(job, jobMaxAgeExceeded, "JOB_MAX_AGE")
+			info.Message = fmt.Sprintf("job is %s old", age.Round(time.Second))
+			jobsList = append(jobsList, info)
 		}
 	}
+	countScanned(ctx, len(jobs.Items))
 	return jobsList, nil
 }
 
+// matchingJobCondition finds the first condition of the job whose type is listed in statuses
+// and whose status is True. A condition can be present with status False or Unknown, for
+// example a Complete condition a controller has not yet confirmed, and never matches then.
+//
+// Parameters:
+// - job: The job to inspect.
+// - statuses: A slice of condition types to match against.
+// - ttl: The duration a job is kept after the condition last transitioned.
+//
+// Returns:
+// - The matching condition type.
+// - The time remaining until the TTL expires, 0 or less if it already has.
+// - A boolean indicating whether a matching condition was found.
+func matchingJobCondition(job batchv1.Job, statuses []string, ttl time.Duration) (string, time.Duration, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status == v1.ConditionTrue && utils.Contains(statuses, string(condition.Type)) {
+			remaining := ttl - time.Since(condition.LastTransitionTime.Time)
+			return string(condition.Type), remaining, true
+		}
+	}
+	return "", 0, false
+}
+
+// jobInfo converts a job and the reason it was selected into a ContainerInfo.
+//
+// Parameters:
+// - job: The job to convert.
+// - status: The matching condition type, or jobMaxAgeExceeded.
+// - rule: The setting that selected the job (e.g., JOB_STATUSES).
+//
+// Returns:
+// - A ContainerInfo describing the job.
+func jobInfo(job batchv1.Job, status, rule string) ContainerInfo {
+	ownerKind, ownerName := controllerOf(&job)
+	return ContainerInfo{
+		Namespace: job.Namespace,
+		PodName:   job.Name,
+		Status:    status,
+		Rule:      rule,
+		OwnerKind: ownerKind,
+		OwnerName: ownerName,
+		CreatedAt: job.CreationTimestamp.Time,
+	}
+}
+
 // DeleteJobs deletes the specified jobs from the given namespace and logs the actions taken.
+// Deletions run concurrently, bounded by the given DeleteLimiter, and throttled deletions are retried.
 //
 // Parameters:
+// - ctx: The context bounding the API calls.
 // - clientset: A Kubernetes clientset to interact with the Kubernetes API.
 // - jobs: A slice of ContainerInfo, each representing a job description with namespace, pod name, and status.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
 // - log: A logger to log messages.
-func DeleteJobs(clientset *kubernetes.Clientset, jobs []ContainerInfo, log *logrus.Logger) {
-	var wg sync.WaitGroup
+//
+// Returns:
+// - The number of jobs that were successfully deleted.
+func DeleteJobs(ctx context.Context, clientset kubernetes.Interface, jobs []ContainerInfo, limiter *DeleteLimiter, log *logrus.Logger) int {
+	propagationPolicy := metav1.DeletePropagationBackground
+	deletions := make([]deletion, 0, len(jobs))
 	for _, job := range jobs {
-		wg.Add(1)
-		go func(job *ContainerInfo) {
-			defer wg.Done()
-			propagationPolicy := metav1.DeletePropagationBackground
-			err := clientset.BatchV1().Jobs(job.Namespace).Delete(context.Background(), job.PodName, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
-			if err != nil {
-				utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("job:%s", job.PodName)}, "Failed to delete job", err)
-			} else {
+		deletions = append(deletions, deletion{
+			kind:      "job",
+			namespace: job.Namespace,
+			fields:    []string{fmt.Sprintf("job:%s", job.PodName)},
+			items:     []ContainerInfo{job},
+			delete: func(ctx context.Context) error {
+				return clientset.BatchV1().Jobs(job.Namespace).Delete(ctx, job.PodName, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+			},
+			get: func(ctx context.Context) (metav1.Object, error) {
+				return clientset.BatchV1().Jobs(job.Namespace).Get(ctx, job.PodName, metav1.GetOptions{})
+			},
+			pruned: func() {
 				metrics.JobsPruned.WithLabelValues(job.Namespace, job.Status).Add(1) // Increment the counter
-				utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("job:%s", job.PodName)}, "Successfully deleted job")
-			}
-		}(&job)
+				report.RecordDeletion("job", job)
+			},
+		})
 	}
-	wg.Wait()
+	return deleteResources(ctx, limiter, deletions)
 }
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// conditionJob returns a job in the default namespace with a single condition that
+// last transitioned an hour ago.
+func conditionJob(name string, conditionType batchv1.JobConditionType, status v1.ConditionStatus) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type:               conditionType,
+			Status:             status,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+		}}},
+	}
+}
+
+func TestMatchingJobCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       *batchv1.Job
+		ttl       time.Duration
+		wantType  string
+		wantMatch bool
+	}{
+		{name: "complete and true", job: conditionJob("done", batchv1.JobComplete, v1.ConditionTrue), wantType: "Complete", wantMatch: true},
+		{name: "complete but false", job: conditionJob("pending", batchv1.JobComplete, v1.ConditionFalse)},
+		{name: "complete but unknown", job: conditionJob("unknown", batchv1.JobComplete, v1.ConditionUnknown)},
+		{name: "type not listed", job: conditionJob("failed", batchv1.JobFailed, v1.ConditionTrue)},
+		{name: "true within the TTL", job: conditionJob("recent", batchv1.JobComplete, v1.ConditionTrue), ttl: 2 * time.Hour, wantType: "Complete", wantMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, remaining, matched := matchingJobCondition(*tt.job, []string{"Complete"}, tt.ttl)
+			if gotType != tt.wantType || matched != tt.wantMatch {
+				t.Errorf("matchingJobCondition() = %q, %v, want %q, %v", gotType, matched, tt.wantType, tt.wantMatch)
+			}
+			if matched && (remaining > 0) != (tt.ttl > time.Hour) {
+				t.Errorf("matchingJobCondition() remaining = %s with TTL %s", remaining, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestGetJobsRequiresTrueCondition(t *testing.T) {
+	jobs := []runtime.Object{
+		conditionJob("done", batchv1.JobComplete, v1.ConditionTrue),
+		conditionJob("not-done", batchv1.JobComplete, v1.ConditionFalse),
+	}
+	got, err := GetJobs(context.Background(), fake.NewSimpleClientset(jobs...), "default", config.Config{JobStatuses: []string{"Complete"}})
+	if err != nil {
+		t.Fatalf("GetJobs() error = %v", err)
+	}
+	if len(got) != 1 || got[0].PodName != "done" {
+		t.Errorf("GetJobs() = %+v, want only done", got)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// JobWatcher watches jobs through a shared informer and prunes them as soon as a
+// matching condition has outlived JOB_TTL, instead of waiting for the next poll.
+// It is an event-driven complement to GetJobs and reuses DeleteJobs for removal.
+type JobWatcher struct {
+	clientset       kubernetes.Interface
+	factory         informers.SharedInformerFactory
+	lister          batchlisters.JobLister
+	queue           workqueue.TypedDelayingInterface[string]
+	inScope         func(namespace string) bool
+	statuses        []string
+	ttl             time.Duration
+	protect         string
+	dryRun          bool
+	requireOptIn    bool
+	namespaceMinAge time.Duration
+	killSwitch      string
+	skipUpgrade     float64
+	limiter         *DeleteLimiter
+	log             *logrus.Logger
+}
+
+// NewJobWatcher creates a new instance of JobWatcher.
+//
+// Parameters:
+// - clientset: A Kubernetes clientset to interact with the Kubernetes API.
+// - inScope: A function reporting whether jobs in the given namespace may be pruned.
+// - cfg: The pruner configuration.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - log: A logger to log messages.
+//
+// Returns:
+// - A pointer to a new instance of JobWatcher.
+// - An error if the event handler could not be registered.
+func NewJobWatcher(clientset kubernetes.Interface, inScope func(namespace string) bool, cfg config.Config, limiter *DeleteLimiter, log *logrus.Logger) (*JobWatcher, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector(cfg.JobLabelSelector)
+	}))
+	w := &JobWatcher{
+		clientset:       clientset,
+		factory:         factory,
+		lister:          factory.Batch().V1().Jobs().Lister(),
+		queue:           workqueue.NewTypedDelayingQueue[string](),
+		inScope:         inScope,
+		statuses:        cfg.JobStatuses,
+		ttl:             cfg.JobTTL,
+		protect:         cfg.ProtectAnnotation,
+		dryRun:          cfg.DryRun,
+		requireOptIn:    cfg.RequireOptIn,
+		namespaceMinAge: cfg.NamespaceMinAge,
+		killSwitch:      cfg.KillSwitchConfigMap,
+		skipUpgrade:     cfg.SkipDuringUpgrade,
+		limiter:         limiter,
+		log:             log,
+	}
+
+	_, err := factory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.enqueue,
+		UpdateFunc: func(_, obj interface{}) { w.enqueue(obj) },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register job event handler: %w", err)
+	}
+	return w, nil
+}
+
+// Run starts the informer and processes queued jobs until stopCh is closed.
+//
+// Parameters:
+// - stopCh: A channel that stops the watcher when closed.
+func (w *JobWatcher) Run(stopCh <-chan struct{}) {
+	w.factory.Start(stopCh)
+	w.factory.WaitForCacheSync(stopCh)
+	utils.LogWithFields(logrus.InfoLevel, []string{}, "Job watcher started")
+
+	go func() {
+		<-stopCh
+		w.queue.ShutDown()
+	}()
+
+	for w.processNext() {
+	}
+}
+
+// enqueue schedules a matching job for deletion once its TTL expires.
+func (w *JobWatcher) enqueue(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok || !w.inScope(job.Namespace) {
+		return
+	}
+	if _, remaining, matched := matchingJobCondition(*job, w.statuses, w.ttl); matched {
+		key, err := cache.MetaNamespaceKeyFunc(job)
+		if err != nil {
+			return
+		}
+		w.queue.AddAfter(key, remaining)
+	}
+}
+
+// processNext takes a single job off the queue, re-checks it against the cache
+// and prunes it if it still matches.
+//
+// Returns:
+// - A boolean indicating whether the queue is still running.
+func (w *JobWatcher) processNext() bool {
+	key, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return true
+	}
+	job, err := w.lister.Jobs(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return true
+	} else if err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("job:%s", key)}, "Error reading job from cache", err)
+		return true
+	}
+
+	status, remaining, matched := matchingJobCondition(*job, w.statuses, w.ttl)
+	if !matched || remaining > 0 || !w.inScope(namespace) || isProtected(context.Background(), job.ObjectMeta, "job", w.protect) {
+		return true
+	}
+	if reason, err := NamespaceSkipReason(context.Background(), w.clientset, namespace, w.requireOptIn, w.namespaceMinAge); err != nil || reason != "" {
+		if err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("job:%s", key)}, "Error checking whether namespace may be pruned", err)
+		}
+		return true
+	}
+
+	item := jobInfo(*job, status, "JOB_STATUSES")
+	if w.dryRun {
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("resources:%s", item)}, "Dry run mode. The following jobs would be deleted")
+		return true
+	}
+	if w.killSwitch != "" {
+		engaged, err := KillSwitchEngaged(context.Background(), w.clientset, w.killSwitch)
+		if err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("job:%s", key)}, "Error reading kill switch, skipping job deletion", err)
+			return true
+		}
+		if engaged {
+			utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("job:%s", key)}, "Kill switch engaged, skipping job deletion")
+			return true
+		}
+	}
+	if w.skipUpgrade > 0 {
+		fraction, cordoned, total, err := CordonedFraction(context.Background(), w.clientset)
+		if err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("job:%s", key)}, "Error checking for cluster maintenance, skipping job deletion", err)
+			return true
+		}
+		if fraction >= w.skipUpgrade {
+			utils.LogWithFields(
+				logrus.WarnLevel,
+				[]string{fmt.Sprintf("job:%s", key), fmt.Sprintf("cordoned:%d", cordoned), fmt.Sprintf("nodes:%d", total), fmt.Sprintf("threshold:%g", w.skipUpgrade)},
+				"Cluster maintenance inferred from cordoned nodes, skipping job deletion",
+			)
+			return true
+		}
+	}
+	DeleteJobs(context.Background(), w.clientset, []ContainerInfo{item}, w.limiter, w.log)
+	return true
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJobWatcherSkipDuringUpgrade(t *testing.T) {
+	node := func(name string, unschedulable bool) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: v1.NodeSpec{Unschedulable: unschedulable}}
+	}
+	tests := []struct {
+		name        string
+		nodes       []runtime.Object
+		wantDeleted bool
+	}{
+		{name: "no maintenance", nodes: []runtime.Object{node("a", false), node("b", false)}, wantDeleted: true},
+		{name: "nodes cordoned for an upgrade", nodes: []runtime.Object{node("a", true), node("b", false)}},
+		{name: "nodes cannot be listed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := conditionJob("done", batchv1.JobComplete, v1.ConditionTrue)
+			objects := append([]runtime.Object{job, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}, tt.nodes...)
+			clientset := fake.NewSimpleClientset(objects...)
+			cfg := config.Config{JobStatuses: []string{"Complete"}, SkipDuringUpgrade: 0.5}
+			limiter := NewDeleteLimiter(1, 1, nil, NewDeleteBackoff(time.Millisecond, time.Millisecond), nil, 0)
+			w, err := NewJobWatcher(clientset, func(string) bool { return true }, cfg, limiter, logrus.New())
+			if err != nil {
+				t.Fatalf("NewJobWatcher() error = %v", err)
+			}
+			if err := w.factory.Batch().V1().Jobs().Informer().GetIndexer().Add(job); err != nil {
+				t.Fatalf("failed to add job to the cache: %v", err)
+			}
+
+			w.queue.Add("default/done")
+			w.processNext()
+
+			_, err = clientset.BatchV1().Jobs("default").Get(context.Background(), "done", metav1.GetOptions{})
+			if deleted := err != nil; deleted != tt.wantDeleted {
+				t.Errorf("job deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
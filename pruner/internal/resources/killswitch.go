@@ -0,0 +1,59 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// killSwitchKey is the key of the kill switch ConfigMap that disables deletions
+// when set to "false".
+const killSwitchKey = "enabled"
+
+// KillSwitchEngaged checks whether the kill switch ConfigMap disables deletions. A
+// missing ConfigMap or key leaves pruning enabled, so the switch only has to exist
+// while it is engaged.
+//
+// Parameters:
+// - ctx: The context bounding the API call.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - ref: The ConfigMap, in the format "namespace/name".
+//
+// Returns:
+// - A boolean indicating whether deletions are disabled.
+// - An error if the ConfigMap could not be fetched.
+func KillSwitchEngaged(ctx context.Context, clientset kubernetes.Interface, ref string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	namespace, name, _ := strings.Cut(ref, "/")
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get kill switch configmap '%s': %w", ref, err)
+	}
+	return strings.TrimSpace(configMap.Data[killSwitchKey]) == "false", nil
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// deletePool is the pool shared by every DeleteLimiter, nil when GLOBAL_DELETE_CONCURRENCY is unset.
+var deletePool atomic.Pointer[DeletePool]
+
+// DeletePool bounds the number of concurrent delete calls across the whole process,
+// so cycles and the job watcher together never exceed it, however many of them overlap.
+type DeletePool struct {
+	slots chan struct{}
+}
+
+// NewDeletePool creates a new instance of DeletePool.
+//
+// Parameters:
+// - size: The maximum number of concurrent delete calls, 0 or less disables the pool.
+//
+// Returns:
+// - A pointer to a new instance of DeletePool, or nil if the pool is disabled.
+func NewDeletePool(size int) *DeletePool {
+	if size <= 0 {
+		return nil
+	}
+	return &DeletePool{slots: make(chan struct{}, size)}
+}
+
+// SetDeletePool sets the pool every DeleteLimiter created afterwards draws its delete
+// slots from.
+//
+// Parameters:
+// - pool: The pool to share, nil to bound each DeleteLimiter on its own.
+func SetDeletePool(pool *DeletePool) {
+	deletePool.Store(pool)
+}
+
+// acquire blocks until a slot is available or ctx is done. It returns immediately on
+// a nil pool.
+func (p *DeletePool) acquire(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return acquireSlot(ctx, p.slots)
+}
+
+// release frees a slot previously obtained with acquire.
+func (p *DeletePool) release() {
+	if p != nil {
+		<-p.slots
+	}
+}
+
+// DeleteLimiter bounds the number of concurrent delete calls made against the
+// Kubernetes API. A global cap is shared by all namespaces, and each namespace is
+// additionally limited to a fair share of it so that a single large namespace
+// cannot starve the others of delete slots. An optional token bucket caps the
+// rate of deletions independently of the client-go QPS settings, and throttled
+// deletes are retried with jittered exponential backoff. An optional DeletionBudget
+// caps the number of deletions per namespace over time, across cycles, and the
+// DeletePool set with SetDeletePool caps delete calls across every DeleteLimiter.
+type DeleteLimiter struct {
+	global        chan struct{}
+	pool          *DeletePool
+	perNamespace  int
+	mu            sync.Mutex
+	namespaces    map[string]chan struct{}
+	rate          *rate.Limiter
+	backoff       RetryBackoff
+	budget        *DeletionBudget
+	verifyTimeout time.Duration
+}
+
+// NewDeleteLimiter creates a new DeleteLimiter.
+//
+// Parameters:
+// - globalLimit: The maximum number of concurrent deletes across all namespaces.
+// - namespaceCount: The number of namespaces sharing the global limit in a cycle.
+// - rateLimiter: An optional token bucket every delete waits on, nil disables rate limiting.
+// - backoff: The backoff between retries of a throttled delete, see NewDeleteBackoff.
+// - budget: An optional per-namespace deletion budget, nil disables it.
+// - verifyTimeout: How long Confirm waits for a deleted object to be gone, 0 disables verification.
+//
+// Returns:
+// - A pointer to a new instance of DeleteLimiter.
+func NewDeleteLimiter(globalLimit, namespaceCount int, rateLimiter *rate.Limiter, backoff RetryBackoff, budget *DeletionBudget, verifyTimeout time.Duration) *DeleteLimiter {
+	if globalLimit < 1 {
+		globalLimit = 1
+	}
+	perNamespace := globalLimit
+	if namespaceCount > 1 {
+		perNamespace = globalLimit / namespaceCount
+	}
+	if perNamespace < 1 {
+		perNamespace = 1
+	}
+
+	return &DeleteLimiter{
+		global:        make(chan struct{}, globalLimit),
+		pool:          deletePool.Load(),
+		perNamespace:  perNamespace,
+		namespaces:    make(map[string]chan struct{}),
+		rate:          rateLimiter,
+		backoff:       backoff,
+		budget:        budget,
+		verifyTimeout: verifyTimeout,
+	}
+}
+
+// NewDeleteRateLimiter creates a token bucket allowing the given number of deletions
+// per second, with a burst of the same size (at least one).
+//
+// Parameters:
+// - perSecond: The number of deletions allowed per second, 0 or less disables rate limiting.
+//
+// Returns:
+// - A pointer to a rate.Limiter, or nil if rate limiting is disabled.
+func NewDeleteRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), max(1, int(perSecond)))
+}
+
+// Acquire blocks until a delete slot is available for the given namespace, or ctx is
+// done. Every call that returns nil must be paired with a call to Release.
+//
+// Parameters:
+// - ctx: The context used to abandon the wait.
+// - namespace: The namespace the delete call is made in.
+//
+// Returns:
+// - An error if ctx is done before a slot is available; no slot is held then.
+func (l *DeleteLimiter) Acquire(ctx context.Context, namespace string) error {
+	semaphore := l.namespace(namespace)
+	if err := acquireSlot(ctx, semaphore); err != nil {
+		return err
+	}
+	if err := acquireSlot(ctx, l.global); err != nil {
+		<-semaphore
+		return err
+	}
+	if err := l.pool.acquire(ctx); err != nil {
+		<-l.global
+		<-semaphore
+		return err
+	}
+	return nil
+}
+
+// acquireSlot blocks until the semaphore has room or ctx is done.
+//
+// Parameters:
+// - ctx: The context used to abandon the wait.
+// - semaphore: The semaphore to take a slot of.
+//
+// Returns:
+// - The context error if ctx is done first.
+func acquireSlot(ctx context.Context, semaphore chan struct{}) error {
+	select {
+	case semaphore <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a delete slot previously obtained with Acquire.
+//
+// Parameters:
+// - namespace: The namespace the delete call was made in.
+func (l *DeleteLimiter) Release(namespace string) {
+	l.pool.release()
+	<-l.global
+	<-l.namespace(namespace)
+}
+
+// SetNamespaceLimit replaces the fair share of the global limit a namespace gets, for
+// namespaces with a deleteConcurrency override. It is still capped by the global
+// limit, and must be called before any delete is made in the namespace.
+//
+// Parameters:
+// - namespace: The namespace to set the limit of.
+// - limit: The maximum number of concurrent deletes in the namespace.
+func (l *DeleteLimiter) SetNamespaceLimit(namespace string, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.namespaces[namespace] = make(chan struct{}, max(1, min(limit, cap(l.global))))
+}
+
+// Reserve takes one deletion from the namespace's DeletionBudget. When it returns
+// true and the deletion then fails, the caller must call Refund.
+//
+// Parameters:
+// - namespace: The namespace the delete call is made in.
+//
+// Returns:
+// - A boolean indicating whether the deletion may proceed.
+func (l *DeleteLimiter) Reserve(namespace string) bool {
+	return l.budget.Reserve(namespace)
+}
+
+// Refund gives back a deletion taken with Reserve that failed.
+//
+// Parameters:
+// - namespace: The namespace the delete call was made in.
+func (l *DeleteLimiter) Refund(namespace string) {
+	l.budget.Refund(namespace)
+}
+
+// Wait blocks until the deletion rate limit allows another delete call.
+// It returns immediately when no rate limit is configured.
+//
+// Parameters:
+// - ctx: The context used to abandon the wait.
+//
+// Returns:
+// - An error if the context is cancelled or its deadline would be exceeded before a token is available.
+func (l *DeleteLimiter) Wait(ctx context.Context) error {
+	if l.rate == nil {
+		return nil
+	}
+	return l.rate.Wait(ctx)
+}
+
+// namespace returns the semaphore for the given namespace, creating it on first use.
+func (l *DeleteLimiter) namespace(namespace string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	semaphore, exists := l.namespaces[namespace]
+	if !exists {
+		semaphore = make(chan struct{}, l.perNamespace)
+		l.namespaces[namespace] = semaphore
+	}
+	return semaphore
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteLimiterAcquireContext(t *testing.T) {
+	limiter := NewDeleteLimiter(1, 1, nil, NewDeleteBackoff(time.Millisecond, time.Millisecond), nil, 0)
+	if err := limiter.Acquire(context.Background(), "default"); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// A full limiter gives up once the context is done, without holding a slot.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(ctx, "other"); err == nil {
+		t.Fatal("Acquire() on a full limiter = nil, want the context error")
+	}
+
+	limiter.Release("default")
+	if err := limiter.Acquire(context.Background(), "other"); err != nil {
+		t.Errorf("Acquire() after Release error = %v", err)
+	}
+}
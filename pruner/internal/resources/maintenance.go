@@ -0,0 +1,79 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CordonedFraction returns the fraction of nodes that are cordoned, either marked
+// unschedulable or carrying the node.kubernetes.io/unschedulable taint, as a
+// heuristic for a cluster upgrade or other maintenance being in progress.
+//
+// Parameters:
+// - ctx: The context bounding the API call.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+//
+// Returns:
+// - The fraction of cordoned nodes, between 0 and 1.
+// - The number of cordoned nodes and the total number of nodes.
+// - An error if the nodes could not be listed or there are none.
+func CordonedFraction(ctx context.Context, clientset kubernetes.Interface) (float64, int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(nodeList.Items) == 0 {
+		return 0, 0, 0, fmt.Errorf("node list is empty")
+	}
+
+	cordoned := 0
+	for _, node := range nodeList.Items {
+		if isCordoned(node) {
+			cordoned++
+		}
+	}
+	return float64(cordoned) / float64(len(nodeList.Items)), cordoned, len(nodeList.Items), nil
+}
+
+// isCordoned checks whether the node is marked unschedulable or tainted as such.
+//
+// Parameters:
+// - node: The node to check.
+//
+// Returns:
+// - A boolean indicating whether the node is cordoned.
+func isCordoned(node v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == v1.TaintNodeUnschedulable {
+			return true
+		}
+	}
+	return false
+}
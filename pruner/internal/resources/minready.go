@@ -0,0 +1,115 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// minReadyCache looks up the minReadySeconds of pod owners, fetching each owner at
+// most once. It is scoped to a single listing so values never go stale.
+type minReadyCache struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	windows   map[string]time.Duration
+}
+
+// newMinReadyCache creates a new, empty minReadyCache.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+//
+// Returns:
+// - A pointer to a new instance of minReadyCache.
+func newMinReadyCache(ctx context.Context, clientset kubernetes.Interface) *minReadyCache {
+	return &minReadyCache{ctx: ctx, clientset: clientset, windows: make(map[string]time.Duration)}
+}
+
+// withinWindow checks whether the pod is younger than the minReadySeconds of its
+// owning ReplicaSet, StatefulSet or DaemonSet, so the controller still considers it
+// freshly created. ReplicaSets inherit minReadySeconds from their Deployment.
+//
+// Parameters:
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether the pod is within its owner's minReadySeconds window.
+// - An error if the owner could not be fetched.
+func (c *minReadyCache) withinWindow(pod v1.Pod) (bool, error) {
+	kind, name := controllerOf(&pod)
+	if kind == "" {
+		return false, nil
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", pod.Namespace, kind, name)
+	window, cached := c.windows[key]
+	if !cached {
+		var err error
+		if window, err = c.lookup(pod.Namespace, kind, name); err != nil {
+			return false, err
+		}
+		c.windows[key] = window
+	}
+	return time.Since(pod.CreationTimestamp.Time) < window, nil
+}
+
+// lookup fetches the minReadySeconds of the given owner.
+//
+// Parameters:
+// - namespace: The namespace of the owner.
+// - kind: The kind of the owner.
+// - name: The name of the owner.
+//
+// Returns:
+// - The minReadySeconds as a duration, 0 for other kinds or owners that no longer exist.
+// - An error if the owner could not be fetched.
+func (c *minReadyCache) lookup(namespace, kind, name string) (time.Duration, error) {
+	var seconds int32
+	var err error
+	switch kind {
+	case "ReplicaSet":
+		rs, getErr := c.clientset.AppsV1().ReplicaSets(namespace).Get(c.ctx, name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			seconds = rs.Spec.MinReadySeconds
+		}
+	case "StatefulSet":
+		sts, getErr := c.clientset.AppsV1().StatefulSets(namespace).Get(c.ctx, name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			seconds = sts.Spec.MinReadySeconds
+		}
+	case "DaemonSet":
+		ds, getErr := c.clientset.AppsV1().DaemonSets(namespace).Get(c.ctx, name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			seconds = ds.Spec.MinReadySeconds
+		}
+	}
+	if errors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s '%s/%s': %w", kind, namespace, name, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PausedAnnotation is the namespace annotation that, when set to "true", pauses
+// pruning in that namespace without redeploying the pruner.
+const PausedAnnotation = "pod-pruner.saidsef.co.uk/paused"
+
+// EnabledAnnotation is the namespace annotation that, when set to "true", opts the
+// namespace in to pruning when REQUIRE_OPT_IN is enabled.
+const EnabledAnnotation = "pod-pruner.saidsef.co.uk/enabled"
+
+// GetNamespaces retrieves the names of all namespaces matching the given label selector.
+//
+// Parameters:
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - selector: A label selector (e.g., "pod-pruner=enabled") used to filter namespaces.
+//
+// Returns:
+// - A slice of namespace names matching the selector.
+// - An error if there is an error while listing the namespaces.
+func GetNamespaces(clientset kubernetes.Interface, selector string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces with selector '%s': %w", selector, err)
+	}
+
+	namespaces := make([]string, 0, len(namespaceList.Items))
+	for _, namespace := range namespaceList.Items {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+// NamespaceSkipReason checks whether pruning is paused in the given namespace through
+// the PausedAnnotation, or, when requireOptIn is set, not enabled through the
+// EnabledAnnotation. Namespaces younger than minAge are skipped too, so the pruner does
+// not race with provisioning (e.g., by CI).
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The name of the namespace to check.
+// - requireOptIn: A boolean indicating whether the namespace must carry the EnabledAnnotation.
+// - minAge: The minimum age of the namespace, 0 to disable.
+//
+// Returns:
+// - A human-readable reason the namespace must be skipped, empty if it may be pruned.
+// - An error if the namespace could not be fetched.
+func NamespaceSkipReason(ctx context.Context, clientset kubernetes.Interface, namespace string, requireOptIn bool, minAge time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace '%s': %w", namespace, err)
+	}
+	if ns.Annotations[PausedAnnotation] == "true" {
+		return fmt.Sprintf("Namespace is paused by %s annotation, skipping", PausedAnnotation), nil
+	}
+	if requireOptIn && ns.Annotations[EnabledAnnotation] != "true" {
+		return fmt.Sprintf("Namespace has not opted in with %s annotation, skipping", EnabledAnnotation), nil
+	}
+	if age := time.Since(ns.CreationTimestamp.Time); age < minAge {
+		return fmt.Sprintf("Namespace is younger than NAMESPACE_MIN_AGE (%s old), skipping", age.Round(time.Second)), nil
+	}
+	return "", nil
+}
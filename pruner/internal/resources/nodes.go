@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeLost is the status reported for pods bound to a node that no longer exists.
+const nodeLost = "NodeLost"
+
+// NodeCache lists the cluster nodes at most once, so every namespace processed in
+// a cycle checks pods against the same snapshot. Create a new one for every cycle.
+type NodeCache struct {
+	clientset kubernetes.Interface
+	once      sync.Once
+	nodes     map[string]struct{}
+	err       error
+}
+
+// NewNodeCache creates a new instance of NodeCache.
+//
+// Parameters:
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+//
+// Returns:
+// - A pointer to a new instance of NodeCache.
+func NewNodeCache(clientset kubernetes.Interface) *NodeCache {
+	return &NodeCache{clientset: clientset}
+}
+
+// names returns the set of existing node names, listing them on first use. An empty
+// node list is treated as an error, since it would make every bound pod look orphaned.
+//
+// Parameters:
+// - ctx: The context bounding the API call.
+//
+// Returns:
+// - A set of node names.
+// - An error if the nodes could not be listed.
+func (c *NodeCache) names(ctx context.Context) (map[string]struct{}, error) {
+	c.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		nodeList, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			c.err = fmt.Errorf("failed to list nodes: %w", err)
+			return
+		}
+		if len(nodeList.Items) == 0 {
+			c.err = fmt.Errorf("node list is empty, refusing to treat every pod as orphaned")
+			return
+		}
+		c.nodes = make(map[string]struct{}, len(nodeList.Items))
+		for _, node := range nodeList.Items {
+			c.nodes[node.Name] = struct{}{}
+		}
+	})
+	return c.nodes, c.err
+}
+
+// GetOrphanedNodePods retrieves the pods in the specified namespace that are bound to
+// a node that no longer exists, as left behind by ungraceful node removals. Pods that
+// are already terminating, or excluded by the pod filters, are never selected.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace from which to retrieve the pods.
+// - nodes: The NodeCache of the current cycle.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of ContainerInfo, each describing a pod bound to a missing node.
+// - An error if the nodes or pods could not be listed.
+func GetOrphanedNodePods(ctx context.Context, clientset kubernetes.Interface, namespace string, nodes *NodeCache, cfg config.Config) ([]ContainerInfo, error) {
+	existing, err := nodes.names(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var pods []ContainerInfo
+	var continueToken string
+	var scanned int
+
+	for {
+		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector(cfg.PodLabelSelector),
+			FieldSelector: podFieldSelector(cfg),
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in namespace '%s': %w", namespace, err)
+		}
+		scanned += len(podList.Items)
+
+		for _, pod := range podList.Items {
+			if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || isExcluded(ctx, pod, cfg) {
+				continue
+			}
+			if _, exists := existing[pod.Spec.NodeName]; exists {
+				continue
+			}
+
+			ownerKind, ownerName := controllerOf(&pod)
+			pods = append(pods, ContainerInfo{
+				Namespace: pod.Namespace,
+				PodName:   pod.Name,
+				Image:     containerImage(pod, ""),
+				Status:    nodeLost,
+				Message:   fmt.Sprintf("node '%s' no longer exists", pod.Spec.NodeName),
+				Rule:      "ORPHANED_NODE_PODS",
+				OwnerKind: ownerKind,
+				OwnerName: ownerName,
+				CreatedAt: pod.CreationTimestamp.Time,
+			})
+		}
+
+		if podList.Continue == "" {
+			break
+		}
+		continueToken = podList.Continue
+	}
+
+	countScanned(ctx, scanned)
+	return pods, nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// notReady is the status reported for running containers that never become Ready.
+const notReady = "NotReady"
+
+// GetNotReadyPods retrieves the running pods in the specified namespace with a
+// container that has started but has not been Ready for longer than NOT_READY_TTL,
+// such as one failing its readiness probe. The time is taken from the pod's Ready
+// condition, and never counts the startup grace of the container: until its startup
+// probe succeeds, and for the initialDelaySeconds of its readiness probe after it
+// started. The pod's Ready condition is captured. When SKIP_SERVICE_ENDPOINTS is
+// enabled, pods still listed as ready Service endpoints are skipped. When NODE_NAME is
+// set, only pods bound to that node are listed.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace from which to retrieve the pods.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of ContainerInfo, each describing a container that is running but not Ready.
+// - An error if there is an error while listing the pods.
+func GetNotReadyPods(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var pods []ContainerInfo
+	var continueToken string
+	var scanned int
+	endpoints := newServiceEndpoints(ctx, clientset)
+
+	for {
+		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector(cfg.PodLabelSelector),
+			FieldSelector: podFieldSelector(cfg, fields.OneTermEqualSelector("status.phase", string(v1.PodRunning))),
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list running pods in namespace '%s': %w", namespace, err)
+		}
+		scanned += len(podList.Items)
+
+		for _, pod := range podList.Items {
+			if pod.DeletionTimestamp != nil || isExcluded(ctx, pod, cfg) {
+				continue
+			}
+			ready := podCondition(pod, v1.PodReady)
+			if ready == nil || ready.Status != v1.ConditionFalse {
+				continue
+			}
+
+			ownerKind, ownerName := controllerOf(&pod)
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				since, ok := notReadySince(pod, containerStatus, ready)
+				if !ok || time.Since(since) < cfg.NotReadyTTL {
+					continue
+				}
+				// EndpointSlices may lag behind the pod's Ready condition.
+				if cfg.SkipServiceEndpoints && isServiceEndpoint(ctx, endpoints, pod) {
+					break
+				}
+				pods = append(pods, ContainerInfo{
+					Namespace:     pod.Namespace,
+					PodName:       pod.Name,
+					ContainerName: containerStatus.Name,
+					Image:         containerStatus.Image,
+					Status:        notReady,
+					Condition:     config.PodCondition{Type: string(ready.Type), Status: string(ready.Status), Reason: ready.Reason}.String(),
+					Message:       ready.Message,
+					Rule:          "NOT_READY_TTL",
+					OwnerKind:     ownerKind,
+					OwnerName:     ownerName,
+					CreatedAt:     pod.CreationTimestamp.Time,
+				})
+			}
+		}
+
+		if podList.Continue == "" {
+			break
+		}
+		continueToken = podList.Continue
+	}
+
+	countScanned(ctx, scanned)
+	return pods, nil
+}
+
+// notReadySince returns when the container was last seen becoming not Ready, the
+// later of the pod's Ready condition transition and the end of the container's
+// startup grace, so a restart or a slow start is never counted as not Ready.
+//
+// Parameters:
+// - pod: The pod the container belongs to.
+// - containerStatus: The status of the container to check.
+// - ready: The pod's Ready condition, with status False.
+//
+// Returns:
+// - The time from which the container has been not Ready.
+// - A boolean indicating whether the container is running and started, but not Ready.
+func notReadySince(pod v1.Pod, containerStatus v1.ContainerStatus, ready *v1.PodCondition) (time.Time, bool) {
+	if containerStatus.Ready || containerStatus.State.Running == nil || containerStatus.Started == nil || !*containerStatus.Started {
+		return time.Time{}, false
+	}
+	since := containerStatus.State.Running.StartedAt.Time
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerStatus.Name && container.ReadinessProbe != nil {
+			since = since.Add(time.Duration(container.ReadinessProbe.InitialDelaySeconds) * time.Second)
+		}
+	}
+	if ready.LastTransitionTime.After(since) {
+		since = ready.LastTransitionTime.Time
+	}
+	return since, !since.IsZero()
+}
+
+// podCondition returns the condition of the given type of the pod.
+//
+// Parameters:
+// - pod: The pod to inspect.
+// - conditionType: The type of the condition (e.g., Ready).
+//
+// Returns:
+// - The condition, or nil if the pod does not report one.
+func podCondition(pod v1.Pod, conditionType v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
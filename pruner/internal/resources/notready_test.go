@@ -0,0 +1,58 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// notReadyPod returns a running pod whose started container has not been Ready for an hour.
+func notReadyPod(name string) *v1.Pod {
+	started, hourAgo := true, metav1.NewTime(time.Now().Add(-time.Hour))
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pod-pruner"},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, LastTransitionTime: hourAgo}},
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:    "app",
+				Started: &started,
+				State:   v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: hourAgo}},
+			}},
+		},
+	}
+}
+
+func TestGetNotReadyPodsExcludesSelf(t *testing.T) {
+	clientset := fake.NewSimpleClientset(notReadyPod("pod-pruner-0"), notReadyPod("web-0"))
+	cfg := config.Config{NotReadyTTL: time.Minute, PodName: "pod-pruner-0", PodNamespace: "pod-pruner"}
+
+	got, err := GetNotReadyPods(context.Background(), clientset, "pod-pruner", cfg)
+	if err != nil {
+		t.Fatalf("GetNotReadyPods() error = %v", err)
+	}
+	if len(got) != 1 || got[0].PodName != "web-0" {
+		t.Errorf("GetNotReadyPods() = %+v, want only web-0", got)
+	}
+}
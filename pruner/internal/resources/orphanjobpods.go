@@ -0,0 +1,121 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetOrphanJobPods retrieves the terminal pods in the specified namespace whose owning
+// Job no longer exists, as left behind when a Job is deleted with Orphan propagation.
+// Pods are only selected once they finished longer ago than POD_TTL_AFTER_FINISHED,
+// and never when excluded by the pod filters. The namespace's jobs are listed once and
+// matched by UID, so a recreated Job with the same name does not count as the owner.
+// When NODE_NAME is set, only pods bound to that node are listed.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace from which to retrieve the pods.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of ContainerInfo, each describing a pod whose Job is gone.
+// - An error if the jobs or pods could not be listed.
+func GetOrphanJobPods(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	jobList, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs in namespace '%s': %w", namespace, err)
+	}
+	jobs := make(map[types.UID]struct{}, len(jobList.Items))
+	for _, job := range jobList.Items {
+		jobs[job.UID] = struct{}{}
+	}
+
+	var pods []ContainerInfo
+	var continueToken string
+	var scanned int
+
+	for {
+		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector(cfg.PodLabelSelector),
+			FieldSelector: podFieldSelector(cfg),
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in namespace '%s': %w", namespace, err)
+		}
+		scanned += len(podList.Items)
+
+		for _, pod := range podList.Items {
+			owner := jobOwner(pod)
+			if owner == nil || pod.DeletionTimestamp != nil || isExcluded(ctx, pod, cfg) {
+				continue
+			}
+			if _, exists := jobs[owner.UID]; exists || !isFinishedPastTTL(pod, cfg.PodTTLAfterFinished) {
+				continue
+			}
+
+			pods = append(pods, ContainerInfo{
+				Namespace: pod.Namespace,
+				PodName:   pod.Name,
+				Image:     containerImage(pod, ""),
+				Status:    string(pod.Status.Phase),
+				Message:   fmt.Sprintf("job '%s' no longer exists", owner.Name),
+				Rule:      "ORPHAN_JOB_PODS",
+				OwnerKind: owner.Kind,
+				OwnerName: owner.Name,
+				CreatedAt: pod.CreationTimestamp.Time,
+			})
+		}
+
+		if podList.Continue == "" {
+			break
+		}
+		continueToken = podList.Continue
+	}
+
+	countScanned(ctx, scanned)
+	return pods, nil
+}
+
+// jobOwner returns the Job owner reference of the given pod, if any.
+//
+// Parameters:
+// - pod: The pod to inspect.
+//
+// Returns:
+// - The Job owner reference, or nil if the pod is not owned by a Job.
+func jobOwner(pod v1.Pod) *metav1.OwnerReference {
+	for i, owner := range pod.OwnerReferences {
+		if owner.Kind == "Job" && owner.APIVersion == "batch/v1" {
+			return &pod.OwnerReferences[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// startingReasons are the waiting reasons of containers that are still being set up,
+// for example while their image is pulled. Pending pods reporting them are making
+// progress and are never selected.
+var startingReasons = []string{"ContainerCreating", "PodInitializing"}
+
+// GetPendingPods retrieves the pods in the specified namespace that have been in the
+// Pending phase for longer than PENDING_TTL. When PENDING_UNSCHEDULABLE_ONLY is enabled,
+// only pods whose PodScheduled condition is False are selected. Pods with a container
+// that is still being created are never selected, so slow image pulls are left alone.
+// The scheduling failure reason and message are captured when present. When NODE_NAME
+// is set, only pods already bound to that node are listed.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace from which to retrieve the pods.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of ContainerInfo, each describing a pod stuck in Pending.
+// - An error if there is an error while listing the pods.
+func GetPendingPods(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var pods []ContainerInfo
+	var continueToken string
+	var scanned int
+
+	for {
+		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector(cfg.PodLabelSelector),
+			FieldSelector: podFieldSelector(cfg, fields.OneTermEqualSelector("status.phase", string(v1.PodPending))),
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pending pods in namespace '%s': %w", namespace, err)
+		}
+		scanned += len(podList.Items)
+
+		for _, pod := range podList.Items {
+			if isExcluded(ctx, pod, cfg) || isStarting(pod) {
+				continue
+			}
+			if time.Since(pod.CreationTimestamp.Time) <= cfg.PendingTTL {
+				continue
+			}
+
+			scheduled := scheduledCondition(pod)
+			unschedulable := scheduled != nil && scheduled.Status == v1.ConditionFalse
+			if cfg.PendingUnschedulableOnly && !unschedulable {
+				continue
+			}
+
+			ownerKind, ownerName := controllerOf(&pod)
+			info := ContainerInfo{
+				Namespace: pod.Namespace,
+				PodName:   pod.Name,
+				Image:     containerImage(pod, ""),
+				Status:    string(v1.PodPending),
+				Rule:      "PENDING_TTL",
+				OwnerKind: ownerKind,
+				OwnerName: ownerName,
+				CreatedAt: pod.CreationTimestamp.Time,
+			}
+			if unschedulable && scheduled.Reason != "" {
+				info.Status, info.Message = scheduled.Reason, scheduled.Message
+			}
+			pods = append(pods, info)
+		}
+
+		if podList.Continue == "" {
+			break
+		}
+		continueToken = podList.Continue
+	}
+
+	countScanned(ctx, scanned)
+	return pods, nil
+}
+
+// scheduledCondition returns the PodScheduled condition of the given pod.
+//
+// Parameters:
+// - pod: The pod to inspect.
+//
+// Returns:
+// - The PodScheduled condition, or nil if the pod does not report one.
+func scheduledCondition(pod v1.Pod) *v1.PodCondition {
+	return podCondition(pod, v1.PodScheduled)
+}
+
+// isStarting checks whether any init or regular container of the pod is still being
+// created, such as while its image is being pulled.
+//
+// Parameters:
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether the pod is still starting up.
+func isStarting(pod v1.Pod) bool {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, containerStatus := range statuses {
+		if containerStatus.State.Waiting != nil && utils.Contains(startingReasons, containerStatus.State.Waiting.Reason) {
+			return true
+		}
+	}
+	return false
+}
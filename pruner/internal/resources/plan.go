@@ -0,0 +1,303 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Plan lists every resource a cycle would delete, grouped by namespace and kind and
+// sorted, so plans of the same cluster state are identical and can be diffed.
+type Plan struct {
+	Namespaces []PlanNamespace `json:"namespaces"` // Namespaces holds the planned deletions per namespace.
+
+	approved map[string]struct{} // approved indexes the planned resources by planKey, set by NewPlan and ReadPlan.
+}
+
+// PlanNamespace lists the planned deletions in a single namespace.
+type PlanNamespace struct {
+	Namespace string     `json:"namespace"` // Namespace is the name of the namespace.
+	Kinds     []PlanKind `json:"kinds"`     // Kinds holds the planned deletions per resource kind.
+}
+
+// PlanKind lists the planned deletions of a single resource kind.
+type PlanKind struct {
+	Kind      string         `json:"kind"`      // Kind is the kind of the resources (e.g., pod, job).
+	Resources []PlanResource `json:"resources"` // Resources holds the planned deletions.
+}
+
+// PlanResource describes a single planned deletion and why it was selected.
+type PlanResource struct {
+	Name      string `json:"name"`                // Name is the name of the resource.
+	Container string `json:"container,omitempty"` // Container is the matching container, empty for pod or job level matches.
+	Status    string `json:"status"`              // Status is the status the resource was selected for.
+	Rule      string `json:"rule"`                // Rule is the setting that selected the resource.
+	Owner     string `json:"owner"`               // Owner is the controlling owner as "Kind/Name", or "none".
+	Message   string `json:"message,omitempty"`   // Message explains the status when Kubernetes provides one.
+}
+
+// NewPlan groups the candidates of a cycle by namespace and kind.
+//
+// Parameters:
+// - candidates: A slice of ContainerInfo selected for pruning.
+//
+// Returns:
+// - A Plan with namespaces, kinds and resources in a deterministic order.
+func NewPlan(candidates []ContainerInfo) Plan {
+	grouped := make(map[string]map[string][]PlanResource)
+	for _, item := range candidates {
+		if grouped[item.Namespace] == nil {
+			grouped[item.Namespace] = make(map[string][]PlanResource)
+		}
+		grouped[item.Namespace][item.Kind()] = append(grouped[item.Namespace][item.Kind()], PlanResource{
+			Name:      item.PodName,
+			Container: item.ContainerName,
+			Status:    item.Status,
+			Rule:      item.Rule,
+			Owner:     item.Owner(),
+			Message:   item.Message,
+		})
+	}
+
+	plan := Plan{Namespaces: make([]PlanNamespace, 0, len(grouped))}
+	for namespace, kinds := range grouped {
+		planNamespace := PlanNamespace{Namespace: namespace, Kinds: make([]PlanKind, 0, len(kinds))}
+		for kind, planResources := range kinds {
+			sort.Slice(planResources, func(i, j int) bool {
+				if planResources[i].Name != planResources[j].Name {
+					return planResources[i].Name < planResources[j].Name
+				}
+				return planResources[i].Container < planResources[j].Container
+			})
+			planNamespace.Kinds = append(planNamespace.Kinds, PlanKind{Kind: kind, Resources: planResources})
+		}
+		sort.Slice(planNamespace.Kinds, func(i, j int) bool {
+			return planNamespace.Kinds[i].Kind < planNamespace.Kinds[j].Kind
+		})
+		plan.Namespaces = append(plan.Namespaces, planNamespace)
+	}
+	sort.Slice(plan.Namespaces, func(i, j int) bool {
+		return plan.Namespaces[i].Namespace < plan.Namespaces[j].Namespace
+	})
+	plan.index()
+	return plan
+}
+
+// ReadPlan reads an approved plan previously written with PLAN_OUTPUT.
+//
+// Parameters:
+// - path: The path of the plan file, in YAML or JSON.
+//
+// Returns:
+// - A pointer to the Plan, ready to filter candidates with.
+// - An error if the file could not be read or parsed.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan '%s': %w", path, err)
+	}
+	var plan Plan
+	if err := yaml.UnmarshalStrict(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan '%s': %w", path, err)
+	}
+
+	plan.index()
+	return &plan, nil
+}
+
+// index builds the approved index Filter looks candidates up in.
+func (p *Plan) index() {
+	p.approved = make(map[string]struct{})
+	for _, namespace := range p.Namespaces {
+		for _, kind := range namespace.Kinds {
+			for _, resource := range kind.Resources {
+				p.approved[planKey(namespace.Namespace, kind.Kind, resource.Name)] = struct{}{}
+			}
+		}
+	}
+}
+
+// Filter keeps the candidates listed in the approved plan, so only resources that
+// were approved and still match the pruning criteria are deleted. Other candidates
+// are logged and skipped. A nil plan keeps every candidate.
+//
+// Parameters:
+// - ctx: The context carrying the namespace log buffer, if any.
+// - candidates: A slice of ContainerInfo selected for pruning.
+//
+// Returns:
+// - The candidates listed in the plan.
+func (p *Plan) Filter(ctx context.Context, candidates []ContainerInfo) []ContainerInfo {
+	if p == nil {
+		return candidates
+	}
+	approved := make([]ContainerInfo, 0, len(candidates))
+	for _, item := range candidates {
+		if _, listed := p.approved[planKey(item.Namespace, item.Kind(), item.PodName)]; !listed {
+			utils.LogWithFieldsContext(ctx, logrus.InfoLevel, []string{fmt.Sprintf("resource:%s", item), fmt.Sprintf("kind:%s", item.Kind())}, "Skipping candidate, not in the approved plan")
+			continue
+		}
+		approved = append(approved, item)
+	}
+	return approved
+}
+
+// ReportSkipped logs every planned resource that was not selected again, and why:
+// either it no longer exists or it no longer matches the pruning criteria.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - candidates: A slice of ContainerInfo selected while applying the plan.
+func (p *Plan) ReportSkipped(ctx context.Context, clientset kubernetes.Interface, candidates []ContainerInfo) {
+	selected := make(map[string]struct{}, len(candidates))
+	for _, item := range candidates {
+		selected[planKey(item.Namespace, item.Kind(), item.PodName)] = struct{}{}
+	}
+
+	for _, namespace := range p.Namespaces {
+		for _, kind := range namespace.Kinds {
+			for _, resource := range kind.Resources {
+				key := planKey(namespace.Namespace, kind.Kind, resource.Name)
+				if _, done := selected[key]; done {
+					continue
+				}
+				selected[key] = struct{}{}
+
+				reason := "no longer matches the pruning criteria"
+				if err := getPlanned(ctx, clientset, namespace.Namespace, kind.Kind, resource.Name); errors.IsNotFound(err) {
+					reason = "no longer exists"
+				} else if err != nil {
+					reason = fmt.Sprintf("could not be checked: %s", err)
+				}
+				utils.LogWithFieldsContext(ctx, logrus.WarnLevel, []string{fmt.Sprintf("resource:%s", key), fmt.Sprintf("reason:%s", reason)}, "Skipping planned resource")
+			}
+		}
+	}
+}
+
+// getPlanned fetches a planned resource to find out whether it still exists.
+//
+// Parameters:
+// - ctx: The context bounding the API call.
+// - clientset: A Kubernetes clientset used to interact with the Kubernetes API.
+// - namespace: The namespace of the resource.
+// - kind: The kind of the resource (e.g., pod, job).
+// - name: The name of the resource.
+//
+// Returns:
+// - An error if the resource could not be fetched, NotFound if it no longer exists.
+func getPlanned(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) error {
+	var err error
+	switch kind {
+	case "job":
+		_, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "configmap":
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		_, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	return err
+}
+
+// PlanDiff lists the resources that started or stopped matching between a baseline
+// plan and the current one, sorted by key so diffs of the same plans are identical.
+type PlanDiff struct {
+	Added   []PlanChange `json:"added"`   // Added holds the resources newly matching since the baseline.
+	Removed []PlanChange `json:"removed"` // Removed holds the baseline resources no longer matching.
+}
+
+// PlanChange describes a single resource that started or stopped matching.
+type PlanChange struct {
+	Key          string `json:"key"`       // Key identifies the resource as "namespace/kind/name[/container]".
+	Namespace    string `json:"namespace"` // Namespace is the namespace of the resource.
+	Kind         string `json:"kind"`      // Kind is the kind of the resource (e.g., pod, job).
+	PlanResource        // PlanResource describes the resource as it appears in its plan.
+}
+
+// DiffPlans compares the current plan against a baseline. Resources are matched by
+// namespace, kind, name and container, so a resource selected for a different status
+// or rule is not reported as a change.
+//
+// Parameters:
+// - baseline: The plan previously written with PLAN_OUTPUT.
+// - current: The plan of the current cycle.
+//
+// Returns:
+// - A PlanDiff with the newly matching and no longer matching resources.
+func DiffPlans(baseline, current Plan) PlanDiff {
+	before, after := baseline.changes(), current.changes()
+	diff := PlanDiff{Added: []PlanChange{}, Removed: []PlanChange{}}
+	for key, change := range after {
+		if _, listed := before[key]; !listed {
+			diff.Added = append(diff.Added, change)
+		}
+	}
+	for key, change := range before {
+		if _, listed := after[key]; !listed {
+			diff.Removed = append(diff.Removed, change)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Key < diff.Added[j].Key })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Key < diff.Removed[j].Key })
+	return diff
+}
+
+// Log logs every resource in the diff, newly matching ones first.
+func (d PlanDiff) Log() {
+	for _, change := range d.Added {
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("resource:%s", change.Key), fmt.Sprintf("status:%s", change.Status), fmt.Sprintf("rule:%s", change.Rule)}, "Resource newly matches since the baseline plan")
+	}
+	for _, change := range d.Removed {
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("resource:%s", change.Key), fmt.Sprintf("status:%s", change.Status), fmt.Sprintf("rule:%s", change.Rule)}, "Resource no longer matches since the baseline plan")
+	}
+}
+
+// changes indexes every planned resource by its diff key.
+//
+// Returns:
+// - A map of diff keys to the planned resources.
+func (p Plan) changes() map[string]PlanChange {
+	changes := make(map[string]PlanChange)
+	for _, namespace := range p.Namespaces {
+		for _, kind := range namespace.Kinds {
+			for _, resource := range kind.Resources {
+				key := planKey(namespace.Namespace, kind.Kind, resource.Name)
+				if resource.Container != "" {
+					key = fmt.Sprintf("%s/%s", key, resource.Container)
+				}
+				changes[key] = PlanChange{Key: key, Namespace: namespace.Namespace, Kind: kind.Kind, PlanResource: resource}
+			}
+		}
+	}
+	return changes
+}
+
+// planKey identifies a planned resource in the format "namespace/kind/name".
+func planKey(namespace, kind, name string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, kind, name)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// prunePolicyResource is the cluster-scoped PrunePolicy custom resource whose status
+// reflects the pruning activity.
+var prunePolicyResource = schema.GroupVersionResource{Group: "pod-pruner.saidsef.co.uk", Version: "v1alpha1", Resource: "prunepolicies"}
+
+// PolicyStatus is the status written to the PrunePolicy after every cycle.
+type PolicyStatus struct {
+	LastRunTime string `json:"lastRunTime"`     // LastRunTime is when the cycle finished, in RFC 3339 format.
+	DryRun      bool   `json:"dryRun"`          // DryRun indicates whether deletions were skipped.
+	Namespaces  int    `json:"namespaces"`      // Namespaces is the number of namespaces processed.
+	Candidates  int    `json:"candidates"`      // Candidates is the number of resources selected for pruning.
+	Pruned      int    `json:"pruned"`          // Pruned is the number of resources deleted.
+	Failed      int    `json:"failed"`          // Failed is the number of namespaces that could not be listed.
+	Error       string `json:"error,omitempty"` // Error describes why the cycle failed as a whole, if it did.
+}
+
+// PolicyStatusReporter writes the outcome of every cycle to the status of a PrunePolicy,
+// so pruning activity is visible with "kubectl get prunepolicy". When the CRD or the
+// PrunePolicy does not exist, the reporter logs it once and disables itself.
+type PolicyStatusReporter struct {
+	client   dynamic.Interface
+	name     string
+	disabled atomic.Bool
+}
+
+// NewPolicyStatusReporter creates a new instance of PolicyStatusReporter.
+//
+// Parameters:
+// - client: A dynamic Kubernetes client used to patch the custom resource.
+// - name: The name of the PrunePolicy to report to.
+//
+// Returns:
+// - A pointer to a new instance of PolicyStatusReporter.
+func NewPolicyStatusReporter(client dynamic.Interface, name string) *PolicyStatusReporter {
+	return &PolicyStatusReporter{client: client, name: name}
+}
+
+// Report merges the given status into the PrunePolicy status subresource. Failures are
+// logged and never interrupt pruning.
+//
+// Parameters:
+// - ctx: The context bounding the API call.
+// - status: The status of the last cycle.
+func (r *PolicyStatusReporter) Report(ctx context.Context, status PolicyStatus) {
+	if r == nil || r.disabled.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{}, "Failed to encode PrunePolicy status", err)
+		return
+	}
+	_, err = r.client.Resource(prunePolicyResource).Patch(ctx, r.name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		r.disabled.Store(true)
+		utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("prunepolicy:%s", r.name)}, "PrunePolicy or its CRD is not installed, disabling STATUS_CR", err)
+		return
+	}
+	if err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("prunepolicy:%s", r.name)}, "Failed to update PrunePolicy status", err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// podFieldSelector combines the given field selector terms with NODE_NAME, so the
+// API server only returns pods bound to that node when it is set.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+// - terms: The field selectors the listing already requires, if any.
+//
+// Returns:
+// - The combined field selector, empty when there is nothing to select on.
+func podFieldSelector(cfg config.Config, terms ...fields.Selector) string {
+	if cfg.NodeName != "" {
+		terms = append(terms, fields.OneTermEqualSelector("spec.nodeName", cfg.NodeName))
+	}
+	return fields.AndSelectors(terms...).String()
+}
+
+// labelSelector renders a label selector for a list call.
+//
+// Parameters:
+// - selector: The label selector, nil to select everything.
+//
+// Returns:
+// - The label selector as a string, empty when selector is nil.
+func labelSelector(selector labels.Selector) string {
+	if selector == nil {
+		return ""
+	}
+	return selector.String()
+}
+
+// podPredicate reports whether a pod may be pruned. Every predicate applies to the
+// pod as a whole, so it is checked once per pod, before any rule is matched.
+type podPredicate struct {
+	setting string                // setting is the setting the predicate enforces, reported when it rejects a pod.
+	accept  func(pod v1.Pod) bool // accept reports whether the pod may be pruned.
+}
+
+// exclusionPredicates builds the predicates shared by every pod resource type from
+// POD_NAME and POD_NAMESPACE, PROTECT_ANNOTATION, SKIP_PVC_MOUNTERS, ONLY_ORPHANS, SKIP_CONTROLLED_PODS,
+// PROTECTED_OWNER_KINDS, DELETE_IMAGE_DENYLIST and DELETE_IMAGE_ALLOWLIST.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A slice of podPredicate, one for each active setting.
+func exclusionPredicates(ctx context.Context, cfg config.Config) []podPredicate {
+	var predicates []podPredicate
+	// Never let a misconfigured rule delete the pruner itself.
+	if cfg.PodName != "" && cfg.PodNamespace != "" {
+		predicates = append(predicates, podPredicate{"POD_NAME", func(pod v1.Pod) bool {
+			return !isSelf(ctx, pod, cfg)
+		}})
+	}
+	// Never touch pods their owners explicitly opted out.
+	if cfg.ProtectAnnotation != "" {
+		predicates = append(predicates, podPredicate{"PROTECT_ANNOTATION", func(pod v1.Pod) bool {
+			return !isProtected(ctx, pod.ObjectMeta, "pod", cfg.ProtectAnnotation)
+		}})
+	}
+	// Leave pods mounting persistent volumes alone so RWO volumes are not stranded.
+	if cfg.SkipPVCMounters {
+		predicates = append(predicates, podPredicate{"SKIP_PVC_MOUNTERS", func(pod v1.Pod) bool {
+			return !mountsPersistentVolumeClaim(pod)
+		}})
+	}
+	// Only consider bare pods (e.g., created by kubectl run) when requested.
+	if cfg.OnlyOrphans {
+		predicates = append(predicates, podPredicate{"ONLY_ORPHANS", func(pod v1.Pod) bool {
+			return len(pod.OwnerReferences) == 0
+		}})
+	}
+	if cfg.SkipControlledPods || len(cfg.ProtectedOwnerKinds) > 0 {
+		setting := "SKIP_CONTROLLED_PODS"
+		if len(cfg.ProtectedOwnerKinds) > 0 {
+			setting = "PROTECTED_OWNER_KINDS"
+		}
+		predicates = append(predicates, podPredicate{setting, func(pod v1.Pod) bool {
+			return !hasProtectedOwner(pod, cfg.SkipControlledPods, cfg.ProtectedOwnerKinds)
+		}})
+	}
+	// Honour the image denylist first, then require an allowlisted image if any are configured.
+	if len(cfg.DeleteImageDenylist) > 0 {
+		predicates = append(predicates, podPredicate{"DELETE_IMAGE_DENYLIST", func(pod v1.Pod) bool {
+			return !runsMatchingImage(pod, cfg.DeleteImageDenylist)
+		}})
+	}
+	if len(cfg.DeleteImageAllowlist) > 0 {
+		predicates = append(predicates, podPredicate{"DELETE_IMAGE_ALLOWLIST", func(pod v1.Pod) bool {
+			return runsMatchingImage(pod, cfg.DeleteImageAllowlist)
+		}})
+	}
+	return predicates
+}
+
+// podPredicates builds the predicates GetContainers applies, the exclusions followed
+// by SCHEDULER_NAME_EXCLUDE, SKIP_IF_ANY_RUNNING, POD_MIN_AGE, RESPECT_MIN_READY and
+// SKIP_SERVICE_ENDPOINTS.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - cfg: The pruner configuration.
+// - minReady: The minReadyCache used by RESPECT_MIN_READY.
+// - endpoints: The serviceEndpoints used by SKIP_SERVICE_ENDPOINTS.
+//
+// Returns:
+// - A slice of podPredicate, all of which must accept a container.
+func podPredicates(ctx context.Context, cfg config.Config, minReady *minReadyCache, endpoints *serviceEndpoints) []podPredicate {
+	predicates := exclusionPredicates(ctx, cfg)
+	// Leave pods whose lifecycle is managed by a specialised scheduler (e.g., batch or spark) alone.
+	if len(cfg.SchedulerNameExclude) > 0 {
+		predicates = append(predicates, podPredicate{"SCHEDULER_NAME_EXCLUDE", func(pod v1.Pod) bool {
+			if !utils.Contains(cfg.SchedulerNameExclude, pod.Spec.SchedulerName) {
+				return true
+			}
+			utils.LogWithFieldsContext(ctx, logrus.DebugLevel, []string{fmt.Sprintf("pod:%s", pod.Name), fmt.Sprintf("namespace:%s", pod.Namespace), fmt.Sprintf("schedulerName:%s", pod.Spec.SchedulerName)}, "Skipping pod, scheduler is excluded by SCHEDULER_NAME_EXCLUDE")
+			return false
+		}})
+	}
+	// Leave partially healthy pods alone, e.g. a crashed sidecar next to a serving container.
+	if cfg.SkipIfAnyRunning {
+		predicates = append(predicates, podPredicate{"SKIP_IF_ANY_RUNNING", func(pod v1.Pod) bool {
+			return !hasRunningContainer(pod)
+		}})
+	}
+	if cfg.PodMinAge > 0 {
+		predicates = append(predicates, podPredicate{"POD_MIN_AGE", func(pod v1.Pod) bool {
+			return time.Since(pod.CreationTimestamp.Time) >= cfg.PodMinAge
+		}})
+	}
+	if cfg.RespectMinReady {
+		// Leave pods the controller still considers freshly created alone.
+		predicates = append(predicates, podPredicate{"RESPECT_MIN_READY", func(pod v1.Pod) bool {
+			within, err := minReady.withinWindow(pod)
+			if err != nil {
+				utils.LogWithFieldsContext(ctx, logrus.WarnLevel, []string{fmt.Sprintf("pod:%s", pod.Name), fmt.Sprintf("namespace:%s", pod.Namespace)}, "Skipping pod, could not check owner minReadySeconds", err)
+				return false
+			}
+			return !within
+		}})
+	}
+	// Leave pods requests are still routed to alone, so deleting them cannot cause errors.
+	if cfg.SkipServiceEndpoints {
+		predicates = append(predicates, podPredicate{"SKIP_SERVICE_ENDPOINTS", func(pod v1.Pod) bool {
+			return !isServiceEndpoint(ctx, endpoints, pod)
+		}})
+	}
+	return predicates
+}
+
+// rejectedBy applies the predicates to the pod in order, stopping at the first
+// one that does not accept it.
+//
+// Parameters:
+// - pod: The pod to check.
+// - predicates: A slice of podPredicate to apply in order.
+//
+// Returns:
+// - The setting of the predicate that rejected the pod, empty if every predicate accepted it.
+func rejectedBy(pod v1.Pod, predicates []podPredicate) string {
+	for _, predicate := range predicates {
+		if !predicate.accept(pod) {
+			return predicate.setting
+		}
+	}
+	return ""
+}
+
+// isSelf checks whether the pod is pod-pruner's own pod, identified by POD_NAME and
+// POD_NAMESPACE. Its own pod is logged at debug level.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - pod: The pod to check.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A boolean indicating whether the pod is pod-pruner's own pod.
+func isSelf(ctx context.Context, pod v1.Pod, cfg config.Config) bool {
+	if pod.Name != cfg.PodName || pod.Namespace != cfg.PodNamespace {
+		return false
+	}
+	utils.LogWithFieldsContext(ctx, logrus.DebugLevel, []string{fmt.Sprintf("pod:%s", pod.Name), fmt.Sprintf("namespace:%s", pod.Namespace)}, "Skipping pod-pruner's own pod")
+	return true
+}
+
+// isProtected checks whether the object is annotated with PROTECT_ANNOTATION set to
+// "true", opting it out of pruning whatever rule selects it. Protected objects are
+// logged at debug level.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - object: The metadata of the pod or job to check.
+// - kind: The kind of the object, for logging (e.g., pod, job).
+// - annotation: The PROTECT_ANNOTATION key, empty to protect nothing.
+//
+// Returns:
+// - A boolean indicating whether the object must be left alone.
+func isProtected(ctx context.Context, object metav1.ObjectMeta, kind, annotation string) bool {
+	if annotation == "" || object.Annotations[annotation] != "true" {
+		return false
+	}
+	utils.LogWithFieldsContext(ctx, logrus.DebugLevel, []string{fmt.Sprintf("%s:%s", kind, object.Name), fmt.Sprintf("namespace:%s", object.Namespace)}, fmt.Sprintf("Skipping %s, protected by PROTECT_ANNOTATION", kind))
+	return true
+}
+
+// isExcluded checks whether the given pod is protected from pruning by any of the
+// exclusionPredicates, whatever it was selected for.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - pod: The pod to check.
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - A boolean indicating whether the pod must be left alone.
+func isExcluded(ctx context.Context, pod v1.Pod, cfg config.Config) bool {
+	return rejectedBy(pod, exclusionPredicates(ctx, cfg)) != ""
+}
+
+// hasRunningContainer checks whether any container of the pod is currently running.
+//
+// Parameters:
+// - pod: The pod to check.
+//
+// Returns:
+// - A boolean indicating whether at least one container is running.
+func hasRunningContainer(pod v1.Pod) bool {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.State.Running != nil {
+			return true
+		}
+	}
+	return false
+}
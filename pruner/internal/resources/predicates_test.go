@@ -0,0 +1,182 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodPredicates(t *testing.T) {
+	claim := v1.Volume{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}
+	isController := true
+	owner := metav1.OwnerReference{Kind: "StatefulSet", Name: "db", Controller: &isController}
+	tests := []struct {
+		name string
+		cfg  config.Config
+		pod  v1.Pod
+		want string
+	}{
+		{
+			name: "no predicates accept every pod",
+			pod:  v1.Pod{},
+		},
+		{
+			name: "pod-pruner's own pod",
+			cfg:  config.Config{PodName: "pod-pruner-0", PodNamespace: "pod-pruner"},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-pruner-0", Namespace: "pod-pruner"}},
+			want: "POD_NAME",
+		},
+		{
+			name: "pod of the same name in another namespace",
+			cfg:  config.Config{PodName: "pod-pruner-0", PodNamespace: "pod-pruner"},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-pruner-0", Namespace: "default"}},
+		},
+		{
+			name: "protect annotation",
+			cfg:  config.Config{ProtectAnnotation: "pod-pruner/protect"},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"pod-pruner/protect": "true"}}},
+			want: "PROTECT_ANNOTATION",
+		},
+		{
+			name: "protect annotation not set to true",
+			cfg:  config.Config{ProtectAnnotation: "pod-pruner/protect"},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"pod-pruner/protect": "false"}}},
+		},
+		{
+			name: "pvc mounter",
+			cfg:  config.Config{SkipPVCMounters: true},
+			pod:  v1.Pod{Spec: v1.PodSpec{Volumes: []v1.Volume{claim}}},
+			want: "SKIP_PVC_MOUNTERS",
+		},
+		{
+			name: "owned pod with only orphans",
+			cfg:  config.Config{OnlyOrphans: true},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{owner}}},
+			want: "ONLY_ORPHANS",
+		},
+		{
+			name: "protected owner kind",
+			cfg:  config.Config{ProtectedOwnerKinds: []string{"StatefulSet"}},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{owner}}},
+			want: "PROTECTED_OWNER_KINDS",
+		},
+		{
+			name: "denylisted image",
+			cfg:  config.Config{DeleteImageDenylist: []*regexp.Regexp{regexp.MustCompile(`^registry\.internal/`)}},
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "registry.internal/app:1"}}}},
+			want: "DELETE_IMAGE_DENYLIST",
+		},
+		{
+			name: "image missing from the allowlist",
+			cfg:  config.Config{DeleteImageAllowlist: []*regexp.Regexp{regexp.MustCompile(`^ci/`)}},
+			pod:  v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:1"}}}},
+			want: "DELETE_IMAGE_ALLOWLIST",
+		},
+		{
+			name: "excluded scheduler",
+			cfg:  config.Config{SchedulerNameExclude: []string{"volcano"}},
+			pod:  v1.Pod{Spec: v1.PodSpec{SchedulerName: "volcano"}},
+			want: "SCHEDULER_NAME_EXCLUDE",
+		},
+		{
+			name: "pod younger than the minimum age",
+			cfg:  config.Config{PodMinAge: time.Hour},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute))}},
+			want: "POD_MIN_AGE",
+		},
+		{
+			name: "pod older than the minimum age",
+			cfg:  config.Config{PodMinAge: time.Hour},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour))}},
+		},
+		{
+			name: "first rejecting predicate is reported",
+			cfg:  config.Config{SkipPVCMounters: true, PodMinAge: time.Hour},
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now())}, Spec: v1.PodSpec{Volumes: []v1.Volume{claim}}},
+			want: "SKIP_PVC_MOUNTERS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicates := podPredicates(context.Background(), tt.cfg, nil, nil)
+			if got := rejectedBy(tt.pod, predicates); got != tt.want {
+				t.Errorf("rejectedBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodListsApplyLabelSelector(t *testing.T) {
+	// labelledPod is bound to a missing node, owned by a deleted Job and finished an
+	// hour ago, so every listing below selects it unless the label selector drops it.
+	labelledPod := func(name, app string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"app": app},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+				OwnerReferences:   []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "gone", UID: "gone"}},
+			},
+			Spec:   v1.PodSpec{NodeName: "gone"},
+			Status: v1.PodStatus{Phase: v1.PodSucceeded, ContainerStatuses: []v1.ContainerStatus{terminatedStatus("app", time.Hour)}},
+		}
+	}
+	tests := []struct {
+		name string
+		get  func(ctx context.Context, clientset kubernetes.Interface, cfg config.Config) ([]ContainerInfo, error)
+	}{
+		{name: "PENDING_PODS", get: func(ctx context.Context, clientset kubernetes.Interface, cfg config.Config) ([]ContainerInfo, error) {
+			return GetPendingPods(ctx, clientset, "default", cfg)
+		}},
+		{name: "ORPHANED_NODE_PODS", get: func(ctx context.Context, clientset kubernetes.Interface, cfg config.Config) ([]ContainerInfo, error) {
+			return GetOrphanedNodePods(ctx, clientset, "default", NewNodeCache(clientset), cfg)
+		}},
+		{name: "ORPHAN_JOB_PODS", get: func(ctx context.Context, clientset kubernetes.Interface, cfg config.Config) ([]ContainerInfo, error) {
+			return GetOrphanJobPods(ctx, clientset, "default", cfg)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				labelledPod("batch", "batch"),
+				labelledPod("web", "web"),
+				&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "present"}},
+			)
+			cfg := config.Config{PodLabelSelector: labels.SelectorFromSet(labels.Set{"app": "batch"}), PendingTTL: time.Minute}
+			got, err := tt.get(context.Background(), clientset, cfg)
+			if err != nil {
+				t.Fatalf("%s error = %v", tt.name, err)
+			}
+			if len(got) != 1 || got[0].PodName != "batch" {
+				t.Errorf("%s selected %+v, want only batch", tt.name, got)
+			}
+		})
+	}
+}
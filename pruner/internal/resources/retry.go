@@ -0,0 +1,246 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	deleteAttempts     = 5                      // deleteAttempts is the maximum number of attempts made for a single delete call.
+	verifyPollInterval = 500 * time.Millisecond // verifyPollInterval is how often a deleted object is checked with VERIFY_DELETION.
+)
+
+// RetryBackoff is a jittered exponential backoff whose delay is clamped to a maximum.
+// Unlike wait.Backoff.Cap, which stops the retries once the delay would exceed it,
+// reaching the maximum keeps every attempt and only stops the delay from growing.
+type RetryBackoff struct {
+	backoff  wait.Backoff  // backoff computes the jittered delays and counts the attempts, without a Cap.
+	maxDelay time.Duration // maxDelay is the longest delay between two attempts, jitter included.
+}
+
+// NewDeleteBackoff creates the backoff used between retries of a throttled delete.
+// The delay starts at base and doubles on every retry, with up to 50% random jitter
+// added so concurrent deletions do not retry in lockstep, and is clamped to maxDelay
+// after the jitter is applied.
+//
+// Parameters:
+// - base: The delay before the first retry.
+// - maxDelay: The maximum delay between retries.
+//
+// Returns:
+// - A RetryBackoff allowing deleteAttempts attempts.
+func NewDeleteBackoff(base, maxDelay time.Duration) RetryBackoff {
+	return RetryBackoff{
+		backoff: wait.Backoff{
+			Duration: base,
+			Factor:   2,
+			Jitter:   0.5,
+			Steps:    deleteAttempts,
+		},
+		maxDelay: maxDelay,
+	}
+}
+
+// withAttempts returns a copy of the backoff allowing the given number of attempts.
+//
+// Parameters:
+// - attempts: The number of attempts, including the first one.
+//
+// Returns:
+// - A RetryBackoff with the same delays and the given number of attempts.
+func (b RetryBackoff) withAttempts(attempts int) RetryBackoff {
+	b.backoff.Steps = attempts
+	return b
+}
+
+// step returns the delay before the next attempt and advances the backoff.
+//
+// Returns:
+// - The jittered delay, clamped to maxDelay.
+func (b *RetryBackoff) step() time.Duration {
+	return min(b.backoff.Step(), b.maxDelay)
+}
+
+// run calls attempt until it succeeds, fails with an error that is not retryable, or
+// every attempt of the backoff was made, sleeping between attempts.
+//
+// Parameters:
+// - ctx: The context used to abandon the retries.
+// - attempt: Makes a single attempt, reporting its error and whether it is worth retrying.
+//
+// Returns:
+// - The error of the last attempt, nil if it succeeded.
+func (b RetryBackoff) run(ctx context.Context, attempt func(ctx context.Context) (bool, error)) error {
+	for attempts := max(b.backoff.Steps, 1); ; attempts-- {
+		retryable, err := attempt(ctx)
+		if err == nil || !retryable || attempts <= 1 {
+			return err
+		}
+
+		timer := time.NewTimer(b.step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Retry runs the delete call fn, retrying it with the limiter backoff while it fails
+// with a retryable API error. Every attempt waits for the deletion rate limit first.
+//
+// Parameters:
+// - ctx: The context used to abandon the retries.
+// - fn: The delete call to make.
+//
+// Returns:
+// - An error if the context is done, the error is not retryable, or the last attempt failed.
+func (l *DeleteLimiter) Retry(ctx context.Context, fn func() error) error {
+	return l.backoff.run(ctx, func(ctx context.Context) (bool, error) {
+		if err := l.Wait(ctx); err != nil {
+			return false, err
+		}
+		err := fn()
+		return isRetryable(err), err
+	})
+}
+
+// VerifyTimeout returns how long a deletion is verified for before it is counted
+// as pruned.
+//
+// Parameters:
+// - cfg: The pruner configuration.
+//
+// Returns:
+// - VERIFY_DELETION_TIMEOUT when VERIFY_DELETION is enabled, 0 otherwise.
+func VerifyTimeout(cfg config.Config) time.Duration {
+	if !cfg.VerifyDeletion {
+		return 0
+	}
+	return cfg.VerifyDeletionTimeout
+}
+
+// Confirm polls until gone reports the deleted object no longer exists, so it is
+// only counted as pruned once it has actually finished terminating. It returns
+// immediately when deletions are not verified.
+//
+// Parameters:
+// - ctx: The context used to abandon the polling.
+// - gone: Checks whether the deleted object no longer exists, see isGone.
+//
+// Returns:
+// - An error if the object still exists after the verify timeout or the context is done.
+func (l *DeleteLimiter) Confirm(ctx context.Context, gone func(ctx context.Context) bool) error {
+	if l.verifyTimeout == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.verifyTimeout)
+	defer cancel()
+	return wait.PollUntilContextCancel(ctx, verifyPollInterval, true, func(ctx context.Context) (bool, error) {
+		return gone(ctx), nil
+	})
+}
+
+// isGone checks the result of getting a deleted object by name. An object that exists
+// but is not terminating is a replacement created under the same name, such as a
+// StatefulSet pod, so the deleted one is gone too. Other errors are retried.
+//
+// Parameters:
+// - object: The object returned by the get call.
+// - err: The error returned by the get call.
+//
+// Returns:
+// - A boolean indicating whether the deleted object no longer exists.
+func isGone(object metav1.Object, err error) bool {
+	if err != nil {
+		return errors.IsNotFound(err)
+	}
+	return object.GetDeletionTimestamp() == nil
+}
+
+// RetryList runs the list call fn, retrying it up to maxRetries times with the given
+// backoff while it fails with a transient error, so a single blip does not skip a
+// namespace for a whole interval. Forbidden, Unauthorized and NotFound errors are
+// returned immediately, since retrying cannot fix them.
+//
+// Parameters:
+// - ctx: The context used to abandon the retries.
+// - maxRetries: The maximum number of retries after the first attempt, 0 to disable.
+// - backoff: The backoff between attempts; its attempts are replaced by maxRetries+1.
+// - fn: The list call to make.
+//
+// Returns:
+// - The listed resources.
+// - An error if the context is done, the error is not retryable, or the last attempt failed.
+func RetryList(ctx context.Context, maxRetries int, backoff RetryBackoff, fn func(ctx context.Context) ([]ContainerInfo, error)) ([]ContainerInfo, error) {
+	var items []ContainerInfo
+	err := backoff.withAttempts(maxRetries+1).run(ctx, func(ctx context.Context) (bool, error) {
+		var err error
+		if items, err = fn(ctx); err == nil {
+			return false, nil
+		}
+		return ctx.Err() == nil && !errors.IsForbidden(err) && !errors.IsUnauthorized(err) && !errors.IsNotFound(err), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// isRetryable checks whether the API error is transient, such as throttling or an
+// overloaded API server, and the call is worth retrying.
+//
+// Parameters:
+// - err: The error returned by the API call.
+//
+// Returns:
+// - A boolean indicating whether the call should be retried.
+func isRetryable(err error) bool {
+	return errors.IsTooManyRequests(err) ||
+		errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsServiceUnavailable(err) ||
+		errors.IsInternalError(err)
+}
+
+// IsUnreachable checks whether the error means the API server could not be reached at
+// all, such as a refused connection or a failed DNS lookup, rather than an error the
+// API server returned for a single namespace (e.g., Forbidden). Context cancellation
+// and deadlines are never reported as unreachable.
+//
+// Parameters:
+// - err: The error returned by the API call.
+//
+// Returns:
+// - A boolean indicating whether the API server is unreachable.
+func IsUnreachable(err error) bool {
+	if err == nil || stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return stderrors.As(err, &netErr)
+}
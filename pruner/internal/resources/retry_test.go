@@ -0,0 +1,120 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryBackoffStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		maxDelay time.Duration
+	}{
+		{name: "base equals max", base: 100 * time.Millisecond, maxDelay: 100 * time.Millisecond},
+		{name: "max reached after a few retries", base: 100 * time.Millisecond, maxDelay: 400 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := NewDeleteBackoff(tt.base, tt.maxDelay)
+			for i := 0; i < 20; i++ {
+				if delay := backoff.step(); delay < min(tt.base, tt.maxDelay) || delay > tt.maxDelay {
+					t.Fatalf("step %d delay = %s, want between %s and %s", i, delay, tt.base, tt.maxDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoffRunAttempts(t *testing.T) {
+	throttled := errors.NewTooManyRequests("throttled", 0)
+	tests := []struct {
+		name         string
+		base         time.Duration
+		maxDelay     time.Duration
+		err          error
+		retryable    bool
+		wantAttempts int
+	}{
+		{name: "base equals max keeps every attempt", base: time.Millisecond, maxDelay: time.Millisecond, err: throttled, retryable: true, wantAttempts: deleteAttempts},
+		{name: "small max keeps every attempt", base: time.Millisecond, maxDelay: 2 * time.Millisecond, err: throttled, retryable: true, wantAttempts: deleteAttempts},
+		{name: "error not retryable", base: time.Millisecond, maxDelay: time.Millisecond, err: errors.NewNotFound(schema.GroupResource{Resource: "pods"}, "a"), wantAttempts: 1},
+		{name: "success", base: time.Millisecond, maxDelay: time.Millisecond, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := NewDeleteBackoff(tt.base, tt.maxDelay).run(context.Background(), func(context.Context) (bool, error) {
+				attempts++
+				return tt.retryable, tt.err
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if err != tt.err {
+				t.Errorf("run() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRetryList(t *testing.T) {
+	transient := errors.NewServiceUnavailable("unavailable")
+	forbidden := errors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	tests := []struct {
+		name         string
+		maxRetries   int
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds first time", maxRetries: 2, wantAttempts: 1},
+		{name: "recovers from transient errors", maxRetries: 2, failures: 2, err: transient, wantAttempts: 3},
+		{name: "retries beyond the backoff growing past its maximum", maxRetries: 10, failures: 10, err: transient, wantAttempts: 11},
+		{name: "gives up after maxRetries", maxRetries: 8, failures: 20, err: transient, wantAttempts: 9, wantErr: true},
+		{name: "retries disabled", maxRetries: 0, failures: 1, err: transient, wantAttempts: 1, wantErr: true},
+		{name: "forbidden is not retried", maxRetries: 5, failures: 5, err: forbidden, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			items, err := RetryList(context.Background(), tt.maxRetries, NewDeleteBackoff(time.Millisecond, 2*time.Millisecond), func(context.Context) ([]ContainerInfo, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return nil, tt.err
+				}
+				return []ContainerInfo{{PodName: "a"}}, nil
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr || (err == nil && len(items) != 1) {
+				t.Errorf("RetryList() = %v, %v, want error %v", items, err, tt.wantErr)
+			}
+		})
+	}
+}
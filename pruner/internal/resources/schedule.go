@@ -0,0 +1,101 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"sync"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+)
+
+// ScanSchedule scans namespaces that are slow to list less often, so a few enormous
+// namespaces do not load the API server every cycle while small ones are still scanned
+// every time. A namespace whose listing took n times SLOW_LIST_THRESHOLD is scanned
+// every n cycles, up to SLOW_LIST_MAX_PERIOD. It is kept in memory for the lifetime of
+// the process and shared by every cycle.
+type ScanSchedule struct {
+	threshold  time.Duration
+	maxPeriod  int
+	mu         sync.Mutex
+	namespaces map[string]*scanState
+}
+
+// scanState is the schedule of a single namespace.
+type scanState struct {
+	period  int // period is the number of cycles between two scans.
+	skipped int // skipped is the number of cycles skipped since the last scan.
+}
+
+// NewScanSchedule creates a new instance of ScanSchedule.
+//
+// Parameters:
+// - threshold: The list duration above which a namespace is scanned less often, 0 or less disables the schedule.
+// - maxPeriod: The maximum number of cycles between two scans of a namespace.
+//
+// Returns:
+// - A pointer to a new instance of ScanSchedule, or nil if the schedule is disabled.
+func NewScanSchedule(threshold time.Duration, maxPeriod int) *ScanSchedule {
+	if threshold <= 0 {
+		return nil
+	}
+	return &ScanSchedule{threshold: threshold, maxPeriod: max(1, maxPeriod), namespaces: make(map[string]*scanState)}
+}
+
+// Due reports whether the namespace should be scanned this cycle, counting the cycle
+// as skipped when it is not. A nil schedule scans every namespace every cycle.
+//
+// Parameters:
+// - namespace: The namespace about to be scanned.
+//
+// Returns:
+// - A boolean indicating whether the namespace is due for a scan.
+func (s *ScanSchedule) Due(namespace string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, exists := s.namespaces[namespace]
+	if !exists || state.skipped+1 >= state.period {
+		if exists {
+			state.skipped = 0
+		}
+		return true
+	}
+	state.skipped++
+	return false
+}
+
+// Observe records how long listing the namespace took, adjusting its period and the
+// scan period gauge. A nil schedule ignores it.
+//
+// Parameters:
+// - namespace: The namespace that was scanned.
+// - listed: The total duration of the list calls made for the namespace.
+func (s *ScanSchedule) Observe(namespace string, listed time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	period := min(s.maxPeriod, max(1, int(listed/s.threshold)))
+	s.namespaces[namespace] = &scanState{period: period}
+	metrics.NamespaceScanPeriod.WithLabelValues(namespace).Set(float64(period))
+}
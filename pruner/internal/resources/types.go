@@ -16,9 +16,254 @@ limitations under the License.
 
 package resources
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resourceTemplate renders resources in logs, nil for the built-in format.
+var resourceTemplate atomic.Pointer[template.Template]
+
+// SetResourceTemplate sets the LOG_RESOURCE_TEMPLATE every resource is rendered with
+// by String, after checking it renders a resource.
+//
+// Parameters:
+// - tmpl: The template to render resources with, nil for the built-in format.
+//
+// Returns:
+// - An error if the template fails to render a resource (e.g., it refers to an unknown field).
+func SetResourceTemplate(tmpl *template.Template) error {
+	if tmpl != nil {
+		if err := tmpl.Execute(new(strings.Builder), ContainerInfo{}); err != nil {
+			return err
+		}
+	}
+	resourceTemplate.Store(tmpl)
+	return nil
+}
+
 // ContainerInfo represents the information of a container within a Kubernetes cluster.
 type ContainerInfo struct {
-	Namespace string // Namespace is the Kubernetes namespace in which the container resides.
-	PodName   string // PodName is the name of the pod that contains the container.
-	Status    string // Status is the current status of the container (e.g., Running, Terminated).
+	Namespace     string    // Namespace is the Kubernetes namespace in which the container resides.
+	PodName       string    // PodName is the name of the pod that contains the container.
+	ContainerName string    // ContainerName is the name of the matching container, empty for pod or job level matches.
+	Image         string    // Image is the image of the matching container, or of the first container for pod level matches.
+	Status        string    // Status is the current status of the container (e.g., Running, Terminated).
+	StateSource   string    // StateSource is the container state Status was read from (waiting, terminated or lastTermination), empty for pod or job level matches.
+	OwnerKind     string    // OwnerKind is the kind of the controlling owner (e.g., ReplicaSet, CronJob), empty if none.
+	OwnerName     string    // OwnerName is the name of the controlling owner, empty if none.
+	MemoryLimit   string    // MemoryLimit is the container memory limit, only captured for OOMKilled containers.
+	CPULimit      string    // CPULimit is the container CPU limit, only captured for OOMKilled containers.
+	Condition     string    // Condition is the matching pod condition as "Type=Status:Reason", only set for POD_CONDITIONS matches.
+	Message       string    // Message explains the status when Kubernetes provides one (e.g., a scheduling failure).
+	Rule          string    // Rule is the setting that selected the resource (e.g., CONTAINER_STATUSES).
+	CreatedAt     time.Time // CreatedAt is the creation timestamp of the pod or job.
+}
+
+// String returns a compact, human-readable representation of the resource in the
+// format "namespace/pod[container]: status", omitting the container when empty, or
+// rendered with LOG_RESOURCE_TEMPLATE when set.
+func (c ContainerInfo) String() string {
+	if tmpl := resourceTemplate.Load(); tmpl != nil {
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, c); err == nil {
+			return rendered.String()
+		}
+	}
+	if c.ContainerName == "" {
+		return fmt.Sprintf("%s/%s: %s", c.Namespace, c.PodName, c.Status)
+	}
+	return fmt.Sprintf("%s/%s[%s]: %s", c.Namespace, c.PodName, c.ContainerName, c.Status)
+}
+
+// Name returns the name of the resource, whatever its kind, for LOG_RESOURCE_TEMPLATE.
+func (c ContainerInfo) Name() string {
+	return c.PodName
+}
+
+// Age returns how long ago the resource was created, rounded to the second,
+// or zero if the creation timestamp is unknown.
+func (c ContainerInfo) Age() time.Duration {
+	if c.CreatedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.CreatedAt).Round(time.Second)
+}
+
+// MarshalJSON encodes the resource with stable, lower camel case field names so
+// logs and reports share a single machine-parseable representation.
+func (c ContainerInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Namespace   string `json:"namespace"`
+		Pod         string `json:"pod"`
+		Container   string `json:"container,omitempty"`
+		Image       string `json:"image,omitempty"`
+		Status      string `json:"status"`
+		StateSource string `json:"stateSource,omitempty"`
+		Age         string `json:"age"`
+		Owner       string `json:"owner"`
+		MemoryLimit string `json:"memoryLimit,omitempty"`
+		CPULimit    string `json:"cpuLimit,omitempty"`
+		Condition   string `json:"condition,omitempty"`
+		Message     string `json:"message,omitempty"`
+		Rule        string `json:"rule,omitempty"`
+	}{
+		Namespace:   c.Namespace,
+		Pod:         c.PodName,
+		Container:   c.ContainerName,
+		Image:       c.Image,
+		Status:      c.Status,
+		StateSource: c.StateSource,
+		Age:         c.Age().String(),
+		Owner:       c.Owner(),
+		MemoryLimit: c.MemoryLimit,
+		CPULimit:    c.CPULimit,
+		Condition:   c.Condition,
+		Message:     c.Message,
+		Rule:        c.Rule,
+	})
+}
+
+// Owner returns the controlling owner of the resource in the format "Kind/Name",
+// or "none" if the resource has no controlling owner.
+func (c ContainerInfo) Owner() string {
+	if c.OwnerKind == "" {
+		return "none"
+	}
+	return fmt.Sprintf("%s/%s", c.OwnerKind, c.OwnerName)
+}
+
+// Kind returns the kind of the resource, derived from the rule that selected it.
+func (c ContainerInfo) Kind() string {
+	switch c.Rule {
+	case "JOB_STATUSES", "JOB_MAX_AGE":
+		return "job"
+	case "ORPHAN_CONFIGMAPS":
+		return "configmap"
+	}
+	return "pod"
+}
+
+// controllerOf returns the kind and name of the controlling owner of the given object.
+// If no owner is marked as controller, the first owner reference is used instead.
+//
+// Parameters:
+// - obj: The Kubernetes object to inspect.
+//
+// Returns:
+// - The kind and name of the owner, or two empty strings if the object has no owners.
+func controllerOf(obj metav1.Object) (string, string) {
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return owner.Kind, owner.Name
+	}
+	if owners := obj.GetOwnerReferences(); len(owners) > 0 {
+		return owners[0].Kind, owners[0].Name
+	}
+	return "", ""
+}
+
+// CountByOwner groups the given resources by namespace and controlling owner and
+// returns the number of distinct resources per group. Multiple entries for the same
+// resource (e.g., several matching containers in one pod) are counted once.
+//
+// Parameters:
+// - items: A slice of ContainerInfo to group.
+//
+// Returns:
+// - A map keyed by "namespace/Kind/Name" with the number of distinct resources per owner.
+func CountByOwner(items []ContainerInfo) map[string]int {
+	seen := make(map[string]struct{}, len(items))
+	counts := make(map[string]int)
+	for _, item := range items {
+		key := fmt.Sprintf("%s/%s", item.Namespace, item.PodName)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		counts[fmt.Sprintf("%s/%s", item.Namespace, item.Owner())]++
+	}
+	return counts
+}
+
+// CountByStatus groups the given resources by namespace and returns the number of
+// entries per status (e.g., Error, OOMKilled) within each namespace.
+//
+// Parameters:
+// - items: A slice of ContainerInfo to group.
+//
+// Returns:
+// - A map keyed by namespace, then by status, with the number of entries per status.
+func CountByStatus(items []ContainerInfo) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	for _, item := range items {
+		if counts[item.Namespace] == nil {
+			counts[item.Namespace] = make(map[string]int)
+		}
+		counts[item.Namespace][item.Status]++
+	}
+	return counts
+}
+
+// PodMatches gathers every entry selected for a single pod (or job or ConfigMap), so
+// a single deletion is reported with all the containers and reasons that matched.
+type PodMatches struct {
+	Namespace string          // Namespace is the namespace of the resource.
+	PodName   string          // PodName is the name of the resource.
+	Matches   []ContainerInfo // Matches holds every entry selected for the resource, in selection order.
+}
+
+// String returns a compact, human-readable representation of the resource in the
+// format "namespace/pod[container: status, ...]", or "namespace/pod: status" when a
+// single entry without a container matched. With LOG_RESOURCE_TEMPLATE, every entry
+// is rendered with the template instead, separated by commas.
+func (p PodMatches) String() string {
+	if resourceTemplate.Load() != nil {
+		rendered := make([]string, 0, len(p.Matches))
+		for _, match := range p.Matches {
+			rendered = append(rendered, match.String())
+		}
+		return strings.Join(rendered, ", ")
+	}
+	if len(p.Matches) == 1 && p.Matches[0].ContainerName == "" {
+		return p.Matches[0].String()
+	}
+	reasons := make([]string, 0, len(p.Matches))
+	for _, match := range p.Matches {
+		if match.ContainerName == "" {
+			reasons = append(reasons, match.Status)
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", match.ContainerName, match.Status))
+	}
+	return fmt.Sprintf("%s/%s[%s]", p.Namespace, p.PodName, strings.Join(reasons, ", "))
+}
+
+// GroupByPod gathers the entries selected for the same resource, as produced when
+// several containers of a pod match, preserving the order resources were first selected in.
+//
+// Parameters:
+// - items: A slice of ContainerInfo to group.
+//
+// Returns:
+// - A slice of PodMatches, one per distinct resource.
+func GroupByPod(items []ContainerInfo) []PodMatches {
+	index := make(map[string]int, len(items))
+	var groups []PodMatches
+	for _, item := range items {
+		key := fmt.Sprintf("%s/%s/%s", item.Namespace, item.Kind(), item.PodName)
+		i, exists := index[key]
+		if !exists {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, PodMatches{Namespace: item.Namespace, PodName: item.PodName})
+		}
+		groups[i].Matches = append(groups[i].Matches, item)
+	}
+	return groups
 }
@@ -0,0 +1,821 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prune runs pod-pruner reconcile cycles, so they can be embedded in other
+// controllers as well as run by the pod-pruner binary.
+package prune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Config holds every setting of the pruner, see LoadConfig.
+type Config = config.Config
+
+// ContainerInfo describes a resource selected for pruning and why.
+type ContainerInfo = resources.ContainerInfo
+
+// DeletionBudget caps the number of deletions per namespace over a sliding hour,
+// see NewDeletionBudget.
+type DeletionBudget = resources.DeletionBudget
+
+// ScanSchedule scans namespaces that are slow to list less often, see NewScanSchedule.
+type ScanSchedule = resources.ScanSchedule
+
+// Plan lists every resource a cycle would delete, see NewPlan and ReadPlan.
+type Plan = resources.Plan
+
+// LoadConfig resolves the configuration from environment variables, applying
+// defaults for anything unset, and validates the result.
+//
+// Returns:
+// - The resolved Config.
+// - An error describing every invalid setting, if any.
+func LoadConfig() (Config, error) {
+	return config.LoadConfig()
+}
+
+// NewDeletionBudget creates a DeletionBudget to share across Reconcile calls.
+//
+// Parameters:
+// - limit: The number of deletions allowed per namespace per hour, 0 or less disables the budget.
+//
+// Returns:
+// - A pointer to a new DeletionBudget, or nil if the budget is disabled.
+func NewDeletionBudget(limit int) *DeletionBudget {
+	return resources.NewDeletionBudget(limit)
+}
+
+// NewScanSchedule creates a ScanSchedule to share across Reconcile calls.
+//
+// Parameters:
+// - threshold: The list duration above which a namespace is scanned less often, 0 or less disables the schedule.
+// - maxPeriod: The maximum number of cycles between two scans of a namespace.
+//
+// Returns:
+// - A pointer to a new ScanSchedule, or nil if the schedule is disabled.
+func NewScanSchedule(threshold time.Duration, maxPeriod int) *ScanSchedule {
+	return resources.NewScanSchedule(threshold, maxPeriod)
+}
+
+// NewPlan builds a Plan from the candidates of a dry run Reconcile, ready to pass
+// back to Reconcile as the approved plan.
+//
+// Parameters:
+// - candidates: A slice of ContainerInfo selected for pruning.
+//
+// Returns:
+// - A Plan with namespaces, kinds and resources in a deterministic order.
+func NewPlan(candidates []ContainerInfo) Plan {
+	return resources.NewPlan(candidates)
+}
+
+// ReadPlan reads an approved plan, to pass to Reconcile.
+//
+// Parameters:
+// - path: The path of the plan file, in YAML or JSON.
+//
+// Returns:
+// - A pointer to the Plan.
+// - An error if the file could not be read or parsed.
+func ReadPlan(path string) (*Plan, error) {
+	return resources.ReadPlan(path)
+}
+
+// Report is the outcome of a Prune call: the cycle summary and every resource selected.
+type Report struct {
+	Summary
+	Resources []ContainerInfo `json:"resources"` // Resources is every resource selected for pruning, deleted unless DryRun is set.
+}
+
+// Prune resolves the namespaces of the configuration and runs a single reconcile
+// cycle, honouring DRY_RUN, DELETE_RATE_PER_SEC and NAMESPACE_HOURLY_BUDGET. It is the
+// entry point for embedding pod-pruner in another controller; the pod-pruner binary
+// is a thin wrapper scheduling cycles around Reconcile.
+//
+// Parameters:
+// - ctx: The context bounding the cycle.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - cfg: The pruner configuration, typically from LoadConfig.
+//
+// Returns:
+// - A Report with the counts of the cycle and every resource selected.
+// - An error if the namespaces could not be resolved, or a namespace could not be pruned or the cycle timed out.
+func Prune(ctx context.Context, clientset kubernetes.Interface, cfg Config) (Report, error) {
+	namespaces, _, err := ResolveNamespaces(clientset, cfg.Namespaces, cfg.NamespaceSelector)
+	if err != nil {
+		return Report{}, err
+	}
+
+	budget := NewDeletionBudget(cfg.NamespaceHourlyBudget)
+	summary, candidates := Reconcile(ctx, nil, clientset, namespaces, cfg, resources.NewDeleteRateLimiter(cfg.DeleteRatePerSec), budget, nil, nil, utils.Logger())
+	report := Report{Summary: summary, Resources: candidates}
+	if summary.TimedOut {
+		return report, fmt.Errorf("reconcile cycle exceeded RECONCILE_TIMEOUT")
+	}
+	if summary.Failed > 0 {
+		return report, fmt.Errorf("%d of %d namespaces could not be pruned", summary.Failed, summary.Namespaces)
+	}
+	return report, nil
+}
+
+// SystemNamespaces lists the namespaces that are never pruned unless
+// ALLOW_SYSTEM_NAMESPACES is explicitly set to "true".
+var SystemNamespaces = []string{"kube-system", "kube-node-lease", "kube-public"}
+
+// Summary describes the outcome of a single reconcile cycle.
+type Summary struct {
+	Namespaces  int           `json:"namespaces"`  // Namespaces is the number of namespaces processed.
+	Candidates  int           `json:"candidates"`  // Candidates is the number of resources selected for pruning.
+	Pruned      int           `json:"pruned"`      // Pruned is the number of resources deleted.
+	Failed      int           `json:"failed"`      // Failed is the number of namespaces that could not be listed.
+	Completed   int           `json:"completed"`   // Completed is the number of namespaces that ran to completion.
+	Deferred    int           `json:"deferred"`    // Deferred is the number of namespaces not scanned this cycle because listing them is slow.
+	TimedOut    bool          `json:"timedOut"`    // TimedOut indicates whether the cycle was cut short by RECONCILE_TIMEOUT.
+	Interrupted bool          `json:"interrupted"` // Interrupted indicates whether the cycle was cut short by a shutdown.
+	Unreachable bool          `json:"unreachable"` // Unreachable indicates whether the cycle was aborted because the API server could not be reached.
+	DryRun      bool          `json:"dryRun"`      // DryRun indicates whether deletions were skipped.
+	Duration    string        `json:"duration"`    // Duration is how long the cycle took.
+	Steps       []StepSummary `json:"steps"`       // Steps has the counts of every resource type processed, by namespace.
+}
+
+// Deleted returns every candidate whose deletion was confirmed during the cycle.
+//
+// Returns:
+// - A slice of ContainerInfo deleted during the cycle, empty in dry run mode.
+func (s Summary) Deleted() []resources.ContainerInfo {
+	var deleted []resources.ContainerInfo
+	for _, step := range s.Steps {
+		deleted = append(deleted, step.deleted...)
+	}
+	return deleted
+}
+
+// StepSummary describes the outcome of a single resource type in a namespace.
+type StepSummary struct {
+	Namespace  string `json:"namespace"`  // Namespace is the namespace processed.
+	Kind       string `json:"kind"`       // Kind is the RESOURCES entry processed (e.g., PODS).
+	Scanned    int    `json:"scanned"`    // Scanned is the number of resources listed.
+	Candidates int    `json:"candidates"` // Candidates is the number of resources selected for pruning.
+	Deleted    int    `json:"deleted"`    // Deleted is the number of resources deleted.
+	Errors     int    `json:"errors"`     // Errors is the number of failed list and delete calls.
+
+	listed  time.Duration             // listed is how long the successful list calls took, for SLOW_LIST_THRESHOLD.
+	deleted []resources.ContainerInfo // deleted are the candidates whose deletion was confirmed, for notifications.
+}
+
+// Reconcile runs a single pruning cycle across every namespace and resource type.
+// Up to NAMESPACE_CONCURRENCY namespaces are processed in parallel, sharing a single
+// DeleteLimiter so each namespace gets a fair share of the global delete budget, and
+// each namespace's logs are buffered and written in one go once it is done.
+// A namespace listed in NAMESPACE_OVERRIDES_FILE gets its own deleteConcurrency
+// instead of the fair share, and is processed in its own deletionOrder.
+// Once all namespaces have been processed it publishes the cluster-wide aggregate
+// metrics, so a single series reflects the overall activity of the cycle.
+// When RECONCILE_TIMEOUT is set, the whole cycle is bounded by it: once exceeded, no
+// further namespaces are started and in-flight API calls are cancelled. Once shutdown
+// is closed no further namespaces are started either, and the in-flight ones run until
+// they finish or ctx is cancelled at the end of SHUTDOWN_GRACE. Once a namespace fails
+// because the API server is unreachable, no further namespaces are started either, so
+// an outage is reported once instead of by every namespace.
+//
+// Parameters:
+// - ctx: The context bounding the cycle, cancelled once the shutdown drain is over.
+// - shutdown: A channel closed when the pruner is shutting down, nil if it never does.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - namespaces: A slice of namespaces to prune.
+// - cfg: The pruner configuration.
+// - deleteRate: An optional token bucket every delete waits on, nil when unlimited.
+// - budget: An optional per-namespace hourly deletion budget, nil when unlimited.
+// - schedule: An optional ScanSchedule scanning slow namespaces less often, nil to scan every namespace.
+// - plan: An optional approved plan candidates must be listed in, nil to prune every candidate.
+// - log: A pointer to a logrus.Logger instance for logging purposes.
+//
+// Returns:
+// - A Summary describing the outcome of the cycle.
+// - A slice of ContainerInfo selected for pruning across all namespaces.
+func Reconcile(ctx context.Context, shutdown <-chan struct{}, clientset kubernetes.Interface, namespaces []string, cfg Config, deleteRate *rate.Limiter, budget *DeletionBudget, schedule *ScanSchedule, plan *Plan, log *logrus.Logger) (Summary, []ContainerInfo) {
+	start := time.Now()
+	metrics.SetStateLabels(cfg.MetricsStateLabels)
+	if cfg.ReconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ReconcileTimeout)
+		defer cancel()
+	}
+
+	var pruned, failed, completed atomic.Int64
+	var unreachable atomic.Bool
+	var mu sync.Mutex
+	var candidates []resources.ContainerInfo
+	var steps []StepSummary
+	deferred := 0
+
+	// Drop system namespaces unless explicitly allowed, regardless of how they were resolved.
+	namespaces = filterSystemNamespaces(namespaces, cfg.AllowSystemNamespaces)
+
+	limiter := resources.NewDeleteLimiter(cfg.DeleteConcurrency, min(cfg.NamespaceConcurrency, len(namespaces)), deleteRate, resources.NewDeleteBackoff(cfg.DeleteRetryBaseDelay, cfg.DeleteRetryMaxDelay), budget, resources.VerifyTimeout(cfg))
+	// Let namespaces that need gentler or more aggressive deletion override their share.
+	for namespace, override := range cfg.NamespaceOverrides {
+		if override.DeleteConcurrency > 0 {
+			limiter.SetNamespaceLimit(namespace, override.DeleteConcurrency)
+		}
+	}
+	nodes := resources.NewNodeCache(clientset)
+	semaphore := make(chan struct{}, cfg.NamespaceConcurrency)
+	var wg sync.WaitGroup
+
+	// Iterate over each namespace defined in the environment variable.
+	for _, namespace := range namespaces {
+		// Scan namespaces that are slow to list only every few cycles.
+		if !schedule.Due(namespace) {
+			deferred++
+			utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("namespace:%s", namespace)}, "Skipping namespace this cycle, listing it exceeds SLOW_LIST_THRESHOLD")
+			continue
+		}
+		// Stop starting new namespaces once the cycle has run out of time or is shutting down.
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		case <-shutdown:
+		}
+		if ctx.Err() != nil || utils.IsClosed(shutdown) || unreachable.Load() {
+			break
+		}
+		wg.Add(1)
+		go func(namespace string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Keep each namespace's logs contiguous when several are processed at once.
+			ctx := ctx
+			if cfg.NamespaceConcurrency > 1 {
+				var buffer *utils.LogBuffer
+				ctx, buffer = utils.WithLogBuffer(ctx)
+				defer buffer.Flush()
+			}
+
+			namespaceCandidates, namespaceSteps, namespacePruned, err := pruneNamespace(ctx, clientset, namespace, cfg.ForNamespace(namespace), limiter, nodes, plan, log)
+			if err != nil {
+				failed.Add(1)
+				if resources.IsUnreachable(err) {
+					unreachable.Store(true)
+				}
+			} else if ctx.Err() == nil {
+				completed.Add(1)
+				var listed time.Duration
+				for _, step := range namespaceSteps {
+					listed += step.listed
+				}
+				schedule.Observe(namespace, listed)
+			}
+			pruned.Add(int64(namespacePruned))
+			mu.Lock()
+			candidates = append(candidates, namespaceCandidates...)
+			steps = append(steps, namespaceSteps...)
+			mu.Unlock()
+		}(namespace)
+	}
+	wg.Wait()
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].Namespace != steps[j].Namespace {
+			return steps[i].Namespace < steps[j].Namespace
+		}
+		order := cfg.DeletionOrderOf(steps[i].Namespace)
+		return deletionRank(order, steps[i].Kind) < deletionRank(order, steps[j].Kind)
+	})
+
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		utils.LogWithFields(
+			logrus.WarnLevel,
+			[]string{fmt.Sprintf("timeout:%s", cfg.ReconcileTimeout)},
+			"Reconcile cycle exceeded RECONCILE_TIMEOUT, remaining work was cancelled",
+		)
+	}
+	if unreachable.Load() {
+		utils.LogWithFields(
+			logrus.ErrorLevel,
+			[]string{
+				fmt.Sprintf("completed:%d", completed.Load()),
+				fmt.Sprintf("failed:%d", failed.Load()),
+				fmt.Sprintf("namespaces:%d", len(namespaces)),
+			},
+			"API server unreachable, aborting reconcile cycle",
+		)
+	}
+	interrupted := utils.IsClosed(shutdown)
+	if interrupted {
+		message := "Shutdown drain finished, in-flight namespaces completed"
+		if ctx.Err() != nil {
+			message = "Shutdown drain exceeded SHUTDOWN_GRACE, remaining work was cancelled"
+		}
+		utils.LogWithFields(
+			logrus.WarnLevel,
+			[]string{
+				fmt.Sprintf("completed:%d", completed.Load()),
+				fmt.Sprintf("namespaces:%d", len(namespaces)),
+			},
+			message,
+		)
+	}
+
+	metrics.ClusterCandidates.Set(float64(len(candidates)))
+	metrics.ClusterPruned.Set(float64(pruned.Load()))
+
+	return Summary{
+		Namespaces:  len(namespaces),
+		Candidates:  len(candidates),
+		Pruned:      int(pruned.Load()),
+		Failed:      int(failed.Load()),
+		Completed:   int(completed.Load()),
+		Deferred:    deferred,
+		TimedOut:    timedOut,
+		Interrupted: interrupted,
+		Unreachable: unreachable.Load(),
+		DryRun:      cfg.DryRun,
+		Duration:    time.Since(start).String(),
+		Steps:       steps,
+	}, candidates
+}
+
+// resourceStep lists the candidates of a single resource type in a namespace.
+type resourceStep struct {
+	resource     string // resource is the RESOURCES entry enabling the step (e.g., PODS).
+	resourceType string // resourceType is the type passed to handlePruning (e.g., "containers").
+	errMessage   string // errMessage is logged when the candidates could not be listed.
+	list         func(ctx context.Context) ([]resources.ContainerInfo, error)
+}
+
+// pruneNamespace prunes every configured resource type in a single namespace. Up to
+// RESOURCE_CONCURRENCY resource types are processed in parallel, so listing and pruning
+// pods can overlap with jobs; with the default of 1 they run one after the other, in
+// DELETION_ORDER.
+//
+// Parameters:
+// - ctx: The context bounding the API calls, cancelled when RECONCILE_TIMEOUT is exceeded.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - namespace: The namespace to prune.
+// - cfg: The pruner configuration.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - nodes: The NodeCache of the current cycle, shared by every namespace.
+// - plan: An optional approved plan candidates must be listed in, nil to prune every candidate.
+// - log: A pointer to a logrus.Logger instance for logging purposes.
+//
+// Returns:
+// - A slice of ContainerInfo selected for pruning in the namespace.
+// - A StepSummary for every resource type processed in the namespace.
+// - The number of resources deleted in the namespace.
+// - An error if a resource type could not be listed within LIST_MAX_RETRIES, in which case no further resource types are started.
+func pruneNamespace(ctx context.Context, clientset kubernetes.Interface, namespace string, cfg config.Config, limiter *resources.DeleteLimiter, nodes *resources.NodeCache, plan *resources.Plan, log *logrus.Logger) ([]resources.ContainerInfo, []StepSummary, int, error) {
+	var candidates []resources.ContainerInfo
+	var summaries []StepSummary
+	pruned := 0
+
+	// Let teams pause pruning in their own namespace, or require them to opt in, and leave new namespaces alone.
+	reason, err := resources.NamespaceSkipReason(ctx, clientset, namespace, cfg.RequireOptIn, cfg.NamespaceMinAge)
+	if err != nil {
+		utils.LogWithFieldsContext(ctx, logrus.ErrorLevel, []string{fmt.Sprintf("namespace:%s", namespace)}, "Error checking whether namespace may be pruned", err)
+		return candidates, summaries, pruned, err
+	}
+	if reason != "" {
+		utils.LogWithFieldsContext(ctx, logrus.InfoLevel, []string{fmt.Sprintf("namespace:%s", namespace)}, reason)
+		return candidates, summaries, pruned, nil
+	}
+
+	steps := []resourceStep{
+		{"PODS", "containers", "Error fetching containers", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetContainers(ctx, clientset, namespace, cfg)
+		}},
+		{"PENDING_PODS", "pending pods", "Error fetching pending pods", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetPendingPods(ctx, clientset, namespace, cfg)
+		}},
+		{"NOTREADY_PODS", "not ready pods", "Error fetching not ready pods", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetNotReadyPods(ctx, clientset, namespace, cfg)
+		}},
+		{"ORPHANED_NODE_PODS", "orphaned node pods", "Error fetching pods on missing nodes", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetOrphanedNodePods(ctx, clientset, namespace, nodes, cfg)
+		}},
+		{"ORPHAN_JOB_PODS", "orphan job pods", "Error fetching pods of deleted jobs", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetOrphanJobPods(ctx, clientset, namespace, cfg)
+		}},
+		{"JOBS", "jobs", "Error fetching jobs", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetJobs(ctx, clientset, namespace, cfg)
+		}},
+		{"ORPHAN_CONFIGMAPS", "configmaps", "Error fetching configmaps", func(ctx context.Context) ([]resources.ContainerInfo, error) {
+			return resources.GetOrphanConfigMaps(ctx, clientset, namespace, cfg)
+		}},
+	}
+
+	// Process resource types in DELETION_ORDER, then any unlisted type in the order above.
+	sort.SliceStable(steps, func(i, j int) bool {
+		return deletionRank(cfg.DeletionOrder, steps[i].resource) < deletionRank(cfg.DeletionOrder, steps[j].resource)
+	})
+
+	var mu sync.Mutex
+	var firstErr error
+	semaphore := make(chan struct{}, cfg.ResourceConcurrency)
+	var wg sync.WaitGroup
+
+	for _, step := range steps {
+		// Check if the resource type is included in the resources to prune.
+		if !utils.Contains(cfg.Resources, step.resource) {
+			continue
+		}
+		semaphore <- struct{}{}
+		// Abandon the namespace once a resource type could not be listed.
+		mu.Lock()
+		abandoned := firstErr != nil
+		mu.Unlock()
+		if abandoned {
+			<-semaphore
+			break
+		}
+
+		wg.Add(1)
+		go func(step resourceStep) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Collect what the step scanned and which calls failed for the cycle summary.
+			counts := &resources.StepCounts{}
+			ctx := resources.WithStepCounts(ctx, counts)
+			summary := StepSummary{Namespace: namespace, Kind: step.resource}
+			defer func() {
+				summary.Scanned, summary.Errors, summary.deleted = counts.Scanned(), counts.Errors(), counts.Deleted()
+				mu.Lock()
+				summaries = append(summaries, summary)
+				mu.Unlock()
+			}()
+
+			listStart := time.Now()
+			items, err := resources.RetryList(ctx, cfg.ListMaxRetries, resources.NewDeleteBackoff(cfg.DeleteRetryBaseDelay, cfg.DeleteRetryMaxDelay), step.list)
+			if err != nil {
+				utils.LogWithFieldsContext(
+					ctx,
+					logrus.ErrorLevel,
+					[]string{fmt.Sprintf("namespace:%s", namespace)},
+					step.errMessage,
+					err,
+				)
+				counts.AddError()
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+
+			summary.listed = time.Since(listStart)
+
+			// Only prune what was approved when applying a plan, and only if it still matches.
+			items = plan.Filter(ctx, items)
+			// Never touch system namespaces, even through a listing spanning every namespace.
+			items = filterSystemCandidates(ctx, items, cfg.AllowSystemNamespaces)
+
+			// Handle pruning logic for the resource type.
+			stepPruned := handlePruning(ctx, step.resourceType, items, cfg, limiter, log, clientset)
+			summary.Candidates, summary.Deleted = len(items), stepPruned
+			mu.Lock()
+			candidates = append(candidates, items...)
+			pruned += stepPruned
+			mu.Unlock()
+		}(step)
+	}
+	wg.Wait()
+
+	return candidates, summaries, pruned, firstErr
+}
+
+// deletionRank returns the position of the resource type in DELETION_ORDER.
+//
+// Parameters:
+// - order: The resource types in the order they are processed in (DELETION_ORDER).
+// - resource: The resource type to look up (e.g., JOBS).
+//
+// Returns:
+// - The index of the resource type, or len(order) if it is not listed.
+func deletionRank(order []string, resource string) int {
+	for i, listed := range order {
+		if listed == resource {
+			return i
+		}
+	}
+	return len(order)
+}
+
+// ResolveNamespaces computes the effective set of namespaces to prune. Explicitly
+// listed NAMESPACES are always included, and when NAMESPACE_SELECTOR is set the
+// namespaces matching it are added to them (the selector augments the explicit list).
+//
+// Parameters:
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - explicit: A slice of namespaces from the NAMESPACES environment variable.
+// - selector: A label selector from the NAMESPACE_SELECTOR environment variable.
+//
+// Returns:
+// - A de-duplicated slice of namespaces to prune.
+// - A string describing which configuration produced the set ("explicit", "selector" or "explicit+selector").
+// - An error if the namespaces could not be listed or the resulting set is empty.
+func ResolveNamespaces(clientset kubernetes.Interface, explicit []string, selector string) ([]string, string, error) {
+	var namespaces []string
+	for _, namespace := range explicit {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" && !utils.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	source := "explicit"
+	if selector != "" {
+		selected, err := resources.GetNamespaces(clientset, selector)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(namespaces) > 0 {
+			source = "explicit+selector"
+		} else {
+			source = "selector"
+		}
+		for _, namespace := range selected {
+			if !utils.Contains(namespaces, namespace) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+	}
+
+	if len(namespaces) == 0 {
+		return nil, "", fmt.Errorf("neither NAMESPACES nor NAMESPACE_SELECTOR resolved to any namespace")
+	}
+	return namespaces, source, nil
+}
+
+// filterSystemNamespaces removes the Kubernetes system namespaces from the given
+// slice unless allow is true. Each dropped namespace is logged as a warning so a
+// misconfigured NAMESPACES value is visible rather than silently ignored.
+//
+// Parameters:
+// - namespaces: A slice of namespaces to filter.
+// - allow: A boolean indicating whether system namespaces may be pruned.
+//
+// Returns:
+// - A slice of namespaces safe to prune.
+func filterSystemNamespaces(namespaces []string, allow bool) []string {
+	if allow {
+		return namespaces
+	}
+
+	filtered := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		if utils.Contains(SystemNamespaces, namespace) {
+			utils.LogWithFields(
+				logrus.WarnLevel,
+				[]string{fmt.Sprintf("namespace:%s", namespace)},
+				"Skipping system namespace, set ALLOW_SYSTEM_NAMESPACES=true to prune it",
+			)
+			continue
+		}
+		filtered = append(filtered, namespace)
+	}
+	return filtered
+}
+
+// filterSystemCandidates removes the candidates living in a Kubernetes system
+// namespace unless allow is true. Namespaces are filtered up front already, this
+// guards listings that span every namespace, whose candidates come from any of them.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - items: A slice of ContainerInfo selected for pruning.
+// - allow: A boolean indicating whether system namespaces may be pruned.
+//
+// Returns:
+// - The candidates outside system namespaces.
+func filterSystemCandidates(ctx context.Context, items []resources.ContainerInfo, allow bool) []resources.ContainerInfo {
+	if allow {
+		return items
+	}
+
+	filtered := make([]resources.ContainerInfo, 0, len(items))
+	for _, item := range items {
+		if utils.Contains(SystemNamespaces, item.Namespace) {
+			utils.LogWithFieldsContext(ctx, logrus.WarnLevel, []string{fmt.Sprintf("resource:%s", item), fmt.Sprintf("namespace:%s", item.Namespace)}, "Skipping candidate in system namespace, set ALLOW_SYSTEM_NAMESPACES=true to prune it")
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// logImpactEstimate logs, per owning controller, how many resources are about to
+// be deleted. This gives an early warning when a selector is broad enough to wipe
+// out every pod of a single Deployment or CronJob.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - resourceType: A string indicating the type of resource being pruned (e.g., "containers" or "jobs").
+// - items: A slice of ContainerInfo representing the resources about to be pruned.
+func logImpactEstimate(ctx context.Context, resourceType string, items []resources.ContainerInfo) {
+	counts := resources.CountByOwner(items)
+	owners := make([]string, 0, len(counts))
+	for owner := range counts {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		utils.LogWithFieldsContext(
+			ctx,
+			logrus.InfoLevel,
+			[]string{
+				fmt.Sprintf("owner:%s", owner),
+				fmt.Sprintf("count:%d", counts[owner]),
+			},
+			fmt.Sprintf("Estimated impact of pruning %s", resourceType),
+		)
+	}
+}
+
+// logCandidates logs every resource that would be deleted with the rule that selected
+// it, used by DRY_RUN_VERBOSE alongside the reasons GetContainers logs for skipped pods.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - resourceType: A string indicating the type of resource being pruned (e.g., "containers" or "jobs").
+// - items: A slice of ContainerInfo representing the resources that would be pruned.
+func logCandidates(ctx context.Context, resourceType string, items []resources.ContainerInfo) {
+	for _, item := range items {
+		fields := []string{fmt.Sprintf("resource:%s", item), fmt.Sprintf("rule:%s", item.Rule)}
+		if item.Message != "" {
+			fields = append(fields, fmt.Sprintf("message:%s", item.Message))
+		}
+		utils.LogWithFieldsContext(ctx, logrus.InfoLevel, fields, fmt.Sprintf("Dry run mode. Selected %s candidate", resourceType))
+	}
+}
+
+// logStatusSummary logs, per namespace, how many resources would be deleted for each
+// status, e.g. "Error: 14, CrashLoopBackOff: 7, OOMKilled: 3". Statuses are ordered
+// by count, then name, which stays readable however many candidates there are.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - resourceType: A string indicating the type of resource being pruned (e.g., "containers" or "jobs").
+// - items: A slice of ContainerInfo representing the resources that would be pruned.
+func logStatusSummary(ctx context.Context, resourceType string, items []resources.ContainerInfo) {
+	counts := resources.CountByStatus(items)
+	namespaces := make([]string, 0, len(counts))
+	for namespace := range counts {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		statusCounts := counts[namespace]
+		statuses := make([]string, 0, len(statusCounts))
+		total := 0
+		for status, count := range statusCounts {
+			statuses = append(statuses, status)
+			total += count
+		}
+		sort.Slice(statuses, func(i, j int) bool {
+			if statusCounts[statuses[i]] != statusCounts[statuses[j]] {
+				return statusCounts[statuses[i]] > statusCounts[statuses[j]]
+			}
+			return statuses[i] < statuses[j]
+		})
+
+		summary := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			summary = append(summary, fmt.Sprintf("%s: %d", status, statusCounts[status]))
+		}
+		utils.LogWithFieldsContext(
+			ctx,
+			logrus.InfoLevel,
+			[]string{
+				fmt.Sprintf("namespace:%s", namespace),
+				fmt.Sprintf("count:%d", total),
+				fmt.Sprintf("statuses:%s", strings.Join(summary, ", ")),
+			},
+			fmt.Sprintf("Dry run mode. Summary of %s that would be deleted", resourceType),
+		)
+	}
+}
+
+// logOOMKilled logs every OOMKilled container candidate together with the resource
+// limits it was running with, so it is clear what was killed before it is pruned.
+//
+// Parameters:
+// - ctx: The context, optionally carrying the LogBuffer of the namespace.
+// - items: A slice of ContainerInfo representing the resources selected for pruning.
+func logOOMKilled(ctx context.Context, items []resources.ContainerInfo) {
+	for _, item := range items {
+		if item.MemoryLimit == "" {
+			continue
+		}
+		utils.LogWithFieldsContext(
+			ctx,
+			logrus.InfoLevel,
+			[]string{
+				fmt.Sprintf("namespace:%s", item.Namespace),
+				fmt.Sprintf("pod:%s", item.PodName),
+				fmt.Sprintf("container:%s", item.ContainerName),
+				fmt.Sprintf("memoryLimit:%s", item.MemoryLimit),
+				fmt.Sprintf("cpuLimit:%s", item.CPULimit),
+			},
+			"OOMKilled container selected for pruning",
+		)
+	}
+}
+
+// handlePruning handles the common logic for pruning resources.
+// It logs the actions taken based on the dry run mode and performs
+// the deletion of specified resources if not in dry run mode.
+//
+// Parameters:
+// - ctx: The context bounding the deletions, cancelled when RECONCILE_TIMEOUT is exceeded.
+// - resourceType: A string indicating the type of resource being pruned (e.g., "containers" or "jobs").
+// - items: A slice of ContainerInfo representing the resource identifiers to be pruned.
+// - cfg: The pruner configuration, providing dry run mode and the selection annotation.
+// - limiter: A DeleteLimiter bounding the number of concurrent delete calls.
+// - log: A pointer to a logrus.Logger instance for logging purposes.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+//
+// Returns:
+// - The number of resources that were deleted (always 0 in dry run mode).
+func handlePruning(ctx context.Context, resourceType string, items []resources.ContainerInfo, cfg config.Config, limiter *resources.DeleteLimiter, log *logrus.Logger, clientset kubernetes.Interface) int {
+	pruned := 0
+	// List each resource once, with every container that matched, as a single deletion covers them all.
+	pods := resources.GroupByPod(items)
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.String())
+	}
+	values := []string{fmt.Sprintf("resources:%s", strings.Join(names, ", "))}
+	logOOMKilled(ctx, items)
+	if len(items) > 0 {
+		if cfg.DryRun {
+			logStatusSummary(ctx, resourceType, items)
+			if cfg.DryRunVerbose {
+				logCandidates(ctx, resourceType, items)
+			}
+			utils.LogWithFieldsContext(
+				ctx,
+				logrus.InfoLevel,
+				values,
+				fmt.Sprintf("Dry run mode. The following %s would be deleted", resourceType),
+			)
+		} else {
+			utils.LogWithFieldsContext(ctx, logrus.InfoLevel,
+				values,
+				fmt.Sprintf("%s to be pruned", resourceType))
+			logImpactEstimate(ctx, resourceType, items)
+			if resourceType == "containers" || resourceType == "pending pods" || resourceType == "not ready pods" || resourceType == "orphan job pods" {
+				pruned = resources.DeleteContainers(ctx, clientset, items, cfg.SelectionAnnotation, cfg.FinalizerAllowlist, limiter, log)
+			} else if resourceType == "orphaned node pods" {
+				pruned = resources.ForceDeletePods(ctx, clientset, items, cfg.SelectionAnnotation, cfg.FinalizerAllowlist, limiter, log)
+			} else if resourceType == "jobs" {
+				pruned = resources.DeleteJobs(ctx, clientset, items, limiter, log)
+			} else if resourceType == "configmaps" {
+				pruned = resources.DeleteConfigMaps(ctx, clientset, items, limiter, log)
+			}
+		}
+
+	} else {
+		utils.LogWithFieldsContext(
+			ctx,
+			logrus.InfoLevel,
+			values,
+			fmt.Sprintf("No %s to prune", resourceType),
+		)
+	}
+	return pruned
+}
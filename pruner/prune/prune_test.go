@@ -0,0 +1,68 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/prune"
+	"github.com/saidsef/pod-pruner/pruner/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestReconcileFromOutsideTheModule only uses the exported API, as an embedding
+// controller would.
+func TestReconcileFromOutsideTheModule(t *testing.T) {
+	t.Setenv("CONTAINER_STATUSES", "CrashLoopBackOff")
+	t.Setenv("DRY_RUN", "true")
+	cfg, err := prune.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	clientset := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "crashing", Namespace: "default"},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+				Name:  "app",
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}}},
+		},
+	)
+
+	budget := prune.NewDeletionBudget(10)
+	schedule := prune.NewScanSchedule(time.Minute, 4)
+	_, candidates := prune.Reconcile(context.Background(), nil, clientset, []string{"default"}, cfg, nil, budget, schedule, nil, utils.Logger())
+	if len(candidates) != 1 || candidates[0].PodName != "crashing" {
+		t.Fatalf("Reconcile() candidates = %+v, want only crashing", candidates)
+	}
+	// Without the metrics server, the cycle still applies METRICS_STATE_LABELS.
+	if got := metrics.StateLabel("CrashLoopBackOff"); got != "CrashLoopBackOff" {
+		t.Errorf("StateLabel(CrashLoopBackOff) = %q after Reconcile, want CrashLoopBackOff", got)
+	}
+
+	plan := prune.NewPlan(candidates)
+	summary, _ := prune.Reconcile(context.Background(), nil, clientset, []string{"default"}, cfg, nil, budget, schedule, &plan, utils.Logger())
+	if summary.Candidates != 1 {
+		t.Errorf("Reconcile() with the plan selected %d candidates, want 1", summary.Candidates)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTable writes the summary as a human-readable table, one row per namespace and
+// resource type followed by the totals, for reading a single run in kubectl logs.
+//
+// Parameters:
+// - w: The writer to write the table to, typically stdout.
+//
+// Returns:
+// - An error if the table could not be written.
+func (s Summary) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tKIND\tSCANNED\tCANDIDATES\tDELETED\tERRORS")
+	var total StepSummary
+	for _, step := range s.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\n", step.Namespace, step.Kind, step.Scanned, step.Candidates, step.Deleted, step.Errors)
+		total.Scanned += step.Scanned
+		total.Candidates += step.Candidates
+		total.Deleted += step.Deleted
+		total.Errors += step.Errors
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%d\t%d\t%d\n", total.Scanned, total.Candidates, total.Deleted, total.Errors)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	footer := fmt.Sprintf("%d of %d namespaces completed in %s", s.Completed, s.Namespaces, s.Duration)
+	if s.Deferred > 0 {
+		footer += fmt.Sprintf(", %d deferred by SLOW_LIST_THRESHOLD", s.Deferred)
+	}
+	if s.Unreachable {
+		footer += ", aborted as the API server was unreachable"
+	}
+	if s.DryRun {
+		footer += " (dry run, nothing was deleted)"
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", footer)
+	return err
+}
@@ -17,31 +17,313 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/saidsef/pod-pruner/pruner/internal/auth"
-	_ "github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/config"
+	"github.com/saidsef/pod-pruner/pruner/internal/metrics"
+	"github.com/saidsef/pod-pruner/pruner/internal/notify"
+	"github.com/saidsef/pod-pruner/pruner/internal/report"
 	"github.com/saidsef/pod-pruner/pruner/internal/resources"
+	"github.com/saidsef/pod-pruner/pruner/prune"
 	"github.com/saidsef/pod-pruner/pruner/utils"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 )
 
+// cycleRunner runs reconcile cycles on behalf of both the ticker and the on-demand
+// trigger, guaranteeing that two cycles never overlap.
+type cycleRunner struct {
+	ctx        context.Context // ctx is cancelled once the shutdown drain is over.
+	shutdown   <-chan struct{} // shutdown is closed on SIGTERM, after which no new namespaces are started.
+	clientset  kubernetes.Interface
+	cfg        config.Config
+	deleteRate *rate.Limiter                   // deleteRate caps deletions per second across cycles, nil when unlimited.
+	budget     *resources.DeletionBudget       // budget caps deletions per namespace per hour across cycles, nil when unlimited.
+	schedule   *resources.ScanSchedule         // schedule scans slow namespaces less often across cycles, nil when disabled.
+	notifier   notify.Notifier                 // notifier receives a summary of every cycle, nil when not configured.
+	status     *resources.PolicyStatusReporter // status receives the outcome of every cycle, nil when STATUS_CR is unset.
+	log        *logrus.Logger
+	mu         sync.Mutex   // mu guards against overlapping cycles.
+	scopeMu    sync.RWMutex // scopeMu protects namespaces, which is also read by the job watcher.
+	namespaces []string     // namespaces is the last successfully resolved set of namespaces.
+	failures   atomic.Int64 // failures is the number of consecutive failed cycles.
+	paused     atomic.Bool  // paused is toggled by SIGUSR1 and SIGUSR2, skipping cycles while set.
+}
+
+// inScope reports whether the given namespace is part of the last resolved set of
+// namespaces and is not a protected system namespace.
+//
+// Parameters:
+// - namespace: The namespace to check.
+//
+// Returns:
+// - A boolean indicating whether resources in the namespace may be pruned.
+func (r *cycleRunner) inScope(namespace string) bool {
+	r.scopeMu.RLock()
+	defer r.scopeMu.RUnlock()
+
+	if !utils.Contains(r.namespaces, namespace) {
+		return false
+	}
+	return r.cfg.AllowSystemNamespaces || !utils.Contains(prune.SystemNamespaces, namespace)
+}
+
+// run resolves the namespaces and performs a single reconcile cycle. If another
+// cycle is already in progress, or the pruner is paused or shutting down, it returns
+// immediately without doing any work.
+//
+// Returns:
+// - The summary of the cycle.
+// - The reason the cycle was skipped (metrics.SkipShutdown, SkipPaused or SkipOverlap), empty if it ran.
+func (r *cycleRunner) run() (prune.Summary, string) {
+	if utils.IsClosed(r.shutdown) {
+		recordSkip(metrics.SkipShutdown, "Skipping reconcile, shutting down")
+		return prune.Summary{}, metrics.SkipShutdown
+	}
+	if r.paused.Load() {
+		recordSkip(metrics.SkipPaused, "Skipping reconcile, paused by SIGUSR1")
+		return prune.Summary{}, metrics.SkipPaused
+	}
+	if !r.mu.TryLock() {
+		recordSkip(metrics.SkipOverlap, "Skipping reconcile, previous cycle still running")
+		return prune.Summary{}, metrics.SkipOverlap
+	}
+	defer r.mu.Unlock()
+
+	// Re-resolve so namespaces matching the selector are picked up as they appear.
+	r.scopeMu.Lock()
+	resolved, _, resolveErr := prune.ResolveNamespaces(r.clientset, r.cfg.Namespaces, r.cfg.NamespaceSelector)
+	if resolveErr != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{}, "Error resolving namespaces, keeping previous set", resolveErr)
+	} else {
+		forgetNamespaces(r.namespaces, resolved)
+		r.namespaces = resolved
+	}
+	namespaces := r.namespaces
+	r.scopeMu.Unlock()
+
+	summary, candidates := prune.Reconcile(r.ctx, r.shutdown, r.clientset, namespaces, r.cycleConfig(), r.deleteRate, r.budget, r.schedule, nil, r.log)
+	r.recordOutcome(resolveErr != nil || summary.TimedOut || summary.Unreachable || (summary.Failed > 0 && summary.Failed == summary.Namespaces-summary.Deferred))
+	r.reportStatus(summary, resolveErr)
+	r.notify(summary, candidates)
+	return summary, ""
+}
+
+// applyPlan runs a single reconcile cycle that only deletes the candidates listed in
+// the approved plan, then logs every planned resource that was skipped and why.
+//
+// Parameters:
+// - plan: The approved plan read from PLAN_INPUT.
+//
+// Returns:
+// - An error if the cycle was incomplete because a namespace failed or the cycle was cut short.
+func (r *cycleRunner) applyPlan(plan *resources.Plan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary, candidates := prune.Reconcile(r.ctx, r.shutdown, r.clientset, r.namespaces, r.cycleConfig(), r.deleteRate, r.budget, nil, plan, r.log)
+	plan.ReportSkipped(r.ctx, r.clientset, candidates)
+	r.reportStatus(summary, nil)
+	r.notify(summary, candidates)
+
+	if summary.Failed > 0 || summary.Completed < summary.Namespaces {
+		return fmt.Errorf("plan was partially applied, %d of %d namespaces completed", summary.Completed, summary.Namespaces)
+	}
+	utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("candidates:%d", summary.Candidates), fmt.Sprintf("pruned:%d", summary.Pruned)}, "Approved plan applied")
+	return nil
+}
+
+// pauseOnSignal pauses reconciliation on SIGUSR1 and resumes it on SIGUSR2, until
+// the pruner shuts down. A cycle already running when SIGUSR1 arrives is left to finish.
+func (r *cycleRunner) pauseOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			paused := sig == syscall.SIGUSR1
+			if r.paused.Swap(paused) == paused {
+				continue
+			}
+			message := "Reconciliation resumed by SIGUSR2"
+			if paused {
+				message = "Reconciliation paused by SIGUSR1, send SIGUSR2 to resume"
+			}
+			utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("paused:%t", paused)}, message)
+		case <-r.shutdown:
+			return
+		}
+	}
+}
+
+// cycleConfig returns the configuration for the next cycle. When the kill switch
+// ConfigMap is engaged, or SKIP_DURING_UPGRADE infers the cluster is under maintenance,
+// the cycle runs in dry run mode, so candidates are still logged but nothing is deleted.
+// If either cannot be checked, deletions are skipped too.
+//
+// Returns:
+// - The configuration to reconcile with.
+func (r *cycleRunner) cycleConfig() config.Config {
+	cfg := r.cfg
+	if cfg.DryRun {
+		return cfg
+	}
+	if cfg.KillSwitchConfigMap != "" {
+		engaged, err := resources.KillSwitchEngaged(r.ctx, r.clientset, cfg.KillSwitchConfigMap)
+		if err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("configmap:%s", cfg.KillSwitchConfigMap)}, "Error reading kill switch, skipping deletions this cycle", err)
+			cfg.DryRun = true
+			return cfg
+		}
+		if engaged {
+			utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("configmap:%s", cfg.KillSwitchConfigMap)}, "Kill switch engaged, skipping deletions this cycle")
+			cfg.DryRun = true
+			return cfg
+		}
+	}
+	if cfg.SkipDuringUpgrade > 0 {
+		fraction, cordoned, total, err := resources.CordonedFraction(r.ctx, r.clientset)
+		if err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{}, "Error checking for cluster maintenance, skipping deletions this cycle", err)
+			cfg.DryRun = true
+		} else if fraction >= cfg.SkipDuringUpgrade {
+			utils.LogWithFields(
+				logrus.WarnLevel,
+				[]string{fmt.Sprintf("cordoned:%d", cordoned), fmt.Sprintf("nodes:%d", total), fmt.Sprintf("threshold:%g", cfg.SkipDuringUpgrade)},
+				"Cluster maintenance inferred from cordoned nodes, skipping deletions this cycle",
+			)
+			cfg.DryRun = true
+		}
+	}
+	return cfg
+}
+
+// recordOutcome updates the consecutive failures gauge. A cycle fails as a whole
+// when namespaces could not be resolved, it timed out, the API server was unreachable, or no namespace could be listed; any
+// other cycle resets the count to 0.
+//
+// Parameters:
+// - failed: A boolean indicating whether the cycle failed.
+func (r *cycleRunner) recordOutcome(failed bool) {
+	if !failed {
+		r.failures.Store(0)
+		metrics.ConsecutiveFailures.Set(0)
+		r.heartbeat()
+		return
+	}
+	failures := r.failures.Add(1)
+	metrics.ConsecutiveFailures.Set(float64(failures))
+	utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("consecutiveFailures:%d", failures)}, "Reconcile cycle failed")
+}
+
+// heartbeat touches HEARTBEAT_FILE after a successful cycle, so an exec liveness probe
+// can check the pruner is still reconciling without going through HTTP.
+func (r *cycleRunner) heartbeat() {
+	if r.cfg.HeartbeatFile == "" {
+		return
+	}
+	if err := utils.Touch(r.cfg.HeartbeatFile); err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("path:%s", r.cfg.HeartbeatFile)}, "Failed to touch heartbeat file", err)
+	}
+}
+
+// reportStatus writes the cycle outcome to the PrunePolicy configured with STATUS_CR.
+//
+// Parameters:
+// - summary: The summary of the cycle.
+// - resolveErr: The error resolving the namespaces of the cycle, if any.
+func (r *cycleRunner) reportStatus(summary prune.Summary, resolveErr error) {
+	status := resources.PolicyStatus{
+		LastRunTime: time.Now().UTC().Format(time.RFC3339),
+		DryRun:      summary.DryRun,
+		Namespaces:  summary.Namespaces,
+		Candidates:  summary.Candidates,
+		Pruned:      summary.Pruned,
+		Failed:      summary.Failed,
+	}
+	switch {
+	case resolveErr != nil:
+		status.Error = resolveErr.Error()
+	case summary.TimedOut:
+		status.Error = "cycle exceeded RECONCILE_TIMEOUT"
+	case summary.Unreachable:
+		status.Error = "API server unreachable, cycle aborted"
+	case summary.Failed > 0:
+		status.Error = fmt.Sprintf("%d of %d namespaces could not be listed", summary.Failed, summary.Namespaces)
+	}
+	r.status.Report(r.ctx, status)
+}
+
+// notify sends the cycle summary to the configured notifiers. Failures are logged
+// and never interrupt pruning.
+//
+// Parameters:
+// - summary: The summary of the cycle.
+// - candidates: A slice of ContainerInfo selected for pruning during the cycle.
+func (r *cycleRunner) notify(summary prune.Summary, candidates []resources.ContainerInfo) {
+	if r.notifier == nil || len(candidates) == 0 {
+		return
+	}
+	err := r.notifier.Notify(context.Background(), notify.Summary{
+		DryRun:     summary.DryRun,
+		Candidates: candidates,
+		Deleted:    summary.Deleted(),
+		Pruned:     summary.Pruned,
+	})
+	if err != nil {
+		utils.LogWithFields(logrus.ErrorLevel, []string{}, "Failed to send notification", err)
+	}
+}
+
 // main is the entry point of the application. It sets up logging,
 // retrieves environment variables, and initiates a Kubernetes client
 // manager to prune specified resources (containers and jobs) in the
 // defined namespaces at regular intervals.
 func main() {
+	once := flag.Bool("once", false, "Run a single reconcile cycle, print a summary table to stdout and exit")
+	checkHeartbeat := flag.Duration("check-heartbeat", 0, "Exit non-zero unless HEARTBEAT_FILE was touched within this duration, for exec liveness probes")
+	flag.Parse()
+
 	log := utils.Logger()
-	// Retrieve the dry run mode from environment variables, defaulting to "true".
-	dryRun := utils.GetEnv("DRY_RUN", "true", log)
-	// Split the NAMESPACES environment variable into a slice.
-	NAMESPACES := strings.Split(os.Getenv("NAMESPACES"), ",")
-	// Split the RESOURCES environment variable into a slice, defaulting to "PODS".
-	RESOURCES := strings.Split(utils.GetEnv("RESOURCES", "PODS", log), ",")
+	// Resolve every setting from environment variables up front.
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		utils.LogWithFields(logrus.FatalLevel, []string{}, "Invalid configuration", err)
+	}
+	// Act as the exec liveness probe, the image having no shell to check the file with.
+	if *checkHeartbeat > 0 {
+		if err := heartbeatFresh(cfg.HeartbeatFile, *checkHeartbeat); err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Heartbeat check failed", err)
+		}
+		return
+	}
+	utils.LogWithFields(logrus.InfoLevel, append([]string{fmt.Sprintf("version:%s", utils.Version)}, cfg.Fields()...), "Configuration resolved")
+
+	// Serve metrics only once the configuration and logger are ready.
+	metrics.StartMetricsServer(cfg)
+	// Push the final values on exit, since one-shot runs end before they are scraped.
+	if cfg.PushgatewayURL != "" {
+		defer func() {
+			if err := metrics.Push(cfg.PushgatewayURL, cfg.PushgatewayJob); err != nil {
+				utils.LogWithFields(logrus.ErrorLevel, []string{fmt.Sprintf("url:%s", cfg.PushgatewayURL)}, "Failed to push metrics to Pushgateway", err)
+			}
+		}()
+	}
 
 	// Create a new Kubernetes client manager.
 	k8sManager := auth.NewKubernetesClientManager(log)
@@ -54,89 +336,286 @@ func main() {
 	ticker := time.NewTicker(120 * time.Second)
 	defer ticker.Stop()
 
-	utils.LogWithFields(logrus.InfoLevel, RESOURCES, "Resources to include in pruner")
-
-	// Main loop that runs every tick.
-	for range ticker.C {
-		// Iterate over each namespace defined in the environment variable.
-		for _, namespace := range NAMESPACES {
-			// Check if "PODS" is included in the resources to prune.
-			if utils.Contains(RESOURCES, "PODS") {
-				// Fetch containers in the current namespace.
-				containers, err := resources.GetContainers(clientset, namespace)
-				if err != nil {
-					utils.LogWithFields(
-						logrus.ErrorLevel,
-						[]string{fmt.Sprintf("namespace:%s", namespace)},
-						"Error fetching containers",
-						err,
-					)
-					continue
-				}
-
-				// Handle pruning logic for containers.
-				handlePruning("containers", containers, dryRun, log, clientset)
-			}
+	utils.LogWithFields(logrus.InfoLevel, cfg.Resources, "Resources to include in pruner")
+	if cfg.DaemonSetMode {
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("node:%s", cfg.NodeName)}, "DaemonSet mode, only pruning pods on this node")
+	} else if cfg.NodeName != "" {
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("node:%s", cfg.NodeName)}, "Only pods bound to this node are considered")
+	}
 
-			// Check if "JOBS" is included in the resources to prune.
-			if utils.Contains(RESOURCES, "JOBS") {
-				// Fetch jobs in the current namespace.
-				jobs, err := resources.GetJobs(clientset, namespace, log)
-				if err != nil {
-					utils.LogWithFields(
-						logrus.ErrorLevel,
-						[]string{fmt.Sprintf("namespace:%s", namespace)},
-						"Error fetching jobs",
-						err,
-					)
-					continue
-				}
-
-				// Handle pruning logic for jobs.
-				handlePruning("jobs", jobs, dryRun, log, clientset)
-			}
+	if cfg.PodName == "" {
+		utils.LogWithFields(logrus.WarnLevel, []string{}, "POD_NAME and POD_NAMESPACE are unset, pod-pruner cannot recognise its own pod")
+	}
+
+	// Resolve the effective namespaces once up front so an empty scope fails fast.
+	namespaces, source, err := prune.ResolveNamespaces(clientset, cfg.Namespaces, cfg.NamespaceSelector)
+	if err != nil {
+		utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to resolve namespaces to prune", err)
+	}
+	utils.LogWithFields(
+		logrus.InfoLevel,
+		[]string{
+			fmt.Sprintf("source:%s", source),
+			fmt.Sprintf("namespaces:%s", strings.Join(namespaces, ",")),
+		},
+		"Namespaces to include in pruner",
+	)
+
+	// Stream an audit record of every deletion to a sidecar when configured.
+	if cfg.AuditSinkAddr != "" {
+		sink, err := report.NewAuditSink(cfg.AuditSinkAddr)
+		if err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Invalid audit sink address", err)
+		}
+		report.SetAuditSink(sink)
+	}
+
+	// Render resources in logs the way the teams reading them expect.
+	if err := resources.SetResourceTemplate(cfg.LogResourceTemplate); err != nil {
+		utils.LogWithFields(logrus.FatalLevel, []string{}, "Invalid LOG_RESOURCE_TEMPLATE", err)
+	}
+
+	// Bound delete calls across cycles and the job watcher, whichever of them are running.
+	resources.SetDeletePool(resources.NewDeletePool(cfg.GlobalDeleteConcurrency))
+
+	// Stop starting new work on SIGTERM, and give in-flight namespaces SHUTDOWN_GRACE to finish.
+	shutdown, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stopSignals()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-shutdown.Done()
+		utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("grace:%s", cfg.ShutdownGrace)}, "Shutdown requested, draining in-flight namespaces")
+		time.AfterFunc(cfg.ShutdownGrace, cancel)
+	}()
+
+	// Print how a cycle's candidates changed since a baseline plan and exit, without deleting anything.
+	if cfg.BaselinePlan != "" {
+		baseline, err := resources.ReadPlan(cfg.BaselinePlan)
+		if err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to read baseline plan", err)
+		}
+		if err := writePlanDiff(ctx, shutdown.Done(), clientset, namespaces, cfg, *baseline, log); err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to diff against baseline plan", err)
+		}
+		return
+	}
+
+	// Print what a cycle would delete and exit, without deleting anything.
+	if cfg.PlanOutput != "" {
+		if err := writePlan(ctx, shutdown.Done(), clientset, namespaces, cfg, log); err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to produce prune plan", err)
+		}
+		return
+	}
+
+	// Report the outcome of every cycle to a PrunePolicy custom resource when configured.
+	var status *resources.PolicyStatusReporter
+	if cfg.StatusCR != "" {
+		client, err := k8sManager.GetDynamicClient()
+		if err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Kubernetes dynamic client error", err)
+		}
+		status = resources.NewPolicyStatusReporter(client, cfg.StatusCR)
+	}
+
+	deleteRate := resources.NewDeleteRateLimiter(cfg.DeleteRatePerSec)
+	budget := resources.NewDeletionBudget(cfg.NamespaceHourlyBudget)
+	// Carry the budget over from the previous process, so restarts do not reset it.
+	budgetStore := resources.NewBudgetStore(clientset, cfg)
+	if err := budget.Restore(ctx, budgetStore); err != nil {
+		utils.LogWithFields(logrus.WarnLevel, []string{}, "Failed to restore deletion budget, starting from an empty one", err)
+	}
+	go budget.Persist(ctx, budgetStore, cfg.BudgetFlushInterval)
+	defer func() {
+		if err := budget.Flush(context.Background(), budgetStore); err != nil {
+			utils.LogWithFields(logrus.WarnLevel, []string{}, "Failed to persist deletion budget on exit", err)
+		}
+	}()
+	runner := &cycleRunner{
+		ctx:        ctx,
+		shutdown:   shutdown.Done(),
+		clientset:  clientset,
+		cfg:        cfg,
+		deleteRate: deleteRate,
+		budget:     budget,
+		schedule:   resources.NewScanSchedule(cfg.SlowListThreshold, cfg.SlowListMaxPeriod),
+		notifier:   notify.New(cfg),
+		status:     status,
+		log:        log,
+		namespaces: namespaces,
+	}
+
+	// Let operators pause and resume reconciliation with SIGUSR1 and SIGUSR2.
+	go runner.pauseOnSignal()
+
+	// Delete only the resources of an approved plan that still match, and exit.
+	if cfg.PlanInput != "" {
+		plan, err := resources.ReadPlan(cfg.PlanInput)
+		if err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to read approved plan", err)
+		}
+		if err := runner.applyPlan(plan); err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to apply approved plan", err)
+		}
+		return
+	}
+
+	// Run a single cycle, e.g. from a CronJob, and print a summary table for kubectl logs.
+	if *once {
+		summary, _ := runner.run()
+		if err := summary.WriteTable(os.Stdout); err != nil {
+			utils.LogWithFields(logrus.ErrorLevel, []string{}, "Failed to write summary table", err)
+		}
+		return
+	}
+
+	// Expose the on-demand trigger only when a token has been configured.
+	if cfg.TriggerToken != "" {
+		metrics.RegisterReconcileTrigger(cfg.TriggerToken, func() (interface{}, string) {
+			return runner.run()
+		})
+		utils.LogWithFields(logrus.InfoLevel, []string{}, "On-demand reconcile endpoint enabled at POST /reconcile")
+	}
+
+	// Optionally prune jobs as soon as they match, in addition to polling.
+	if cfg.JobInformer && utils.Contains(cfg.Resources, "JOBS") {
+		inScope := func(namespace string) bool {
+			return !runner.paused.Load() && runner.inScope(namespace)
+		}
+		watcher, err := resources.NewJobWatcher(clientset, inScope, cfg, resources.NewDeleteLimiter(cfg.DeleteConcurrency, 1, deleteRate, resources.NewDeleteBackoff(cfg.DeleteRetryBaseDelay, cfg.DeleteRetryMaxDelay), budget, resources.VerifyTimeout(cfg)), log)
+		if err != nil {
+			utils.LogWithFields(logrus.FatalLevel, []string{}, "Unable to create job watcher", err)
+		}
+		go watcher.Run(ctx.Done())
+	}
+
+	// Main loop that runs every tick, until shutdown.
+	for {
+		select {
+		case <-ticker.C:
+			runner.run()
+		case <-shutdown.Done():
+			// Wait for a cycle started through the on-demand trigger to drain as well.
+			runner.mu.Lock()
+			utils.LogWithFields(logrus.InfoLevel, []string{}, "Shutdown complete")
+			return
 		}
 	}
 }
 
-// handlePruning handles the common logic for pruning resources.
-// It logs the actions taken based on the dry run mode and performs
-// the deletion of specified resources if not in dry run mode.
+// forgetNamespaces removes the per-namespace gauge series of every namespace that is
+// no longer part of the resolved set, e.g. because it was deleted, so dashboards do
+// not keep showing its last values forever.
 //
 // Parameters:
-// - resourceType: A string indicating the type of resource being pruned (e.g., "containers" or "jobs").
-// - items: A slice of ContainerInfo representing the resource identifiers to be pruned.
-// - dryRun: A string indicating whether the operation is a dry run ("true" or "false").
-// - log: A pointer to a logrus.Logger instance for logging purposes.
-// - clientset: A pointer to a Kubernetes Clientset for interacting with the Kubernetes API.
-func handlePruning(resourceType string, items []resources.ContainerInfo, dryRun string, log *logrus.Logger, clientset *kubernetes.Clientset) {
-	var values []string
-	for _, item := range items {
-		values = append(values, item.Namespace, item.PodName, item.Status)
-	}
-	if len(items) > 0 {
-		if dryRun == "true" {
-			utils.LogWithFields(
-				logrus.InfoLevel,
-				values,
-				fmt.Sprintf("Dry run mode. The following %s would be deleted", resourceType),
-			)
-		} else {
-			utils.LogWithFields(logrus.InfoLevel,
-				values,
-				fmt.Sprintf("%s to be pruned", resourceType))
-			if resourceType == "containers" {
-				resources.DeleteContainers(clientset, items, log)
-			} else if resourceType == "jobs" {
-				resources.DeleteJobs(clientset, items, log)
-			}
+// - previous: A slice of namespaces resolved for the previous cycle.
+// - current: A slice of namespaces resolved for the next cycle.
+func forgetNamespaces(previous, current []string) {
+	for _, namespace := range previous {
+		if !utils.Contains(current, namespace) {
+			metrics.ForgetNamespace(namespace)
+			utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("namespace:%s", namespace)}, "Namespace left the pruning scope, removed its gauges")
 		}
+	}
+}
 
-	} else {
-		utils.LogWithFields(
-			logrus.InfoLevel,
-			values,
-			fmt.Sprintf("No %s to prune", resourceType),
-		)
+// recordSkip counts and logs a reconcile cycle that was deliberately skipped, so
+// "nothing to prune" can be told apart from "did not run" in monitoring.
+//
+// Parameters:
+// - reason: A short machine-readable reason used as the metric label (e.g., "overlap").
+// - message: A human-readable message to log.
+func recordSkip(reason, message string) {
+	metrics.ReconcileSkipped.WithLabelValues(reason).Inc()
+	utils.LogWithFields(logrus.WarnLevel, []string{fmt.Sprintf("reason:%s", reason)}, message)
+}
+
+// heartbeatFresh checks that HEARTBEAT_FILE was touched recently.
+//
+// Parameters:
+// - path: The path of the heartbeat file.
+// - maxAge: The maximum age of its modification time.
+//
+// Returns:
+// - An error if the path is unset, the file cannot be read or it is older than maxAge.
+func heartbeatFresh(path string, maxAge time.Duration) error {
+	if path == "" {
+		return fmt.Errorf("HEARTBEAT_FILE is not set")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if age := time.Since(info.ModTime()); age > maxAge {
+		return fmt.Errorf("last heartbeat was %s ago, more than %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// writePlan runs a single dry run cycle and prints every candidate to stdout as a
+// PLAN_OUTPUT document, grouped by namespace and kind.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - shutdown: A channel closed on SIGTERM, after which no new namespaces are started.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - namespaces: The namespaces to plan.
+// - cfg: The pruner configuration.
+// - log: A pointer to a logrus.Logger instance for logging purposes.
+//
+// Returns:
+// - An error if the plan could not be encoded or written, or is incomplete because a namespace failed or the cycle was cut short.
+func writePlan(ctx context.Context, shutdown <-chan struct{}, clientset kubernetes.Interface, namespaces []string, cfg config.Config, log *logrus.Logger) error {
+	cfg.DryRun = true
+	summary, candidates := prune.Reconcile(ctx, shutdown, clientset, namespaces, cfg, nil, nil, nil, nil, log)
+
+	out, err := yaml.Marshal(resources.NewPlan(candidates))
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	if summary.Failed > 0 || summary.Completed < summary.Namespaces {
+		return fmt.Errorf("plan is incomplete, %d of %d namespaces completed", summary.Completed, summary.Namespaces)
+	}
+	utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("candidates:%d", summary.Candidates), fmt.Sprintf("namespaces:%d", summary.Namespaces)}, "Prune plan written")
+	return nil
+}
+
+// writePlanDiff runs a single dry run cycle and prints, as JSON to stdout, the
+// candidates that started or stopped matching since the baseline plan.
+//
+// Parameters:
+// - ctx: The context bounding the API calls.
+// - shutdown: A channel closed on SIGTERM, after which no new namespaces are started.
+// - clientset: A Kubernetes clientset for interacting with the Kubernetes API.
+// - namespaces: The namespaces to plan.
+// - cfg: The pruner configuration.
+// - baseline: The plan read from BASELINE_PLAN.
+// - log: A pointer to a logrus.Logger instance for logging purposes.
+//
+// Returns:
+// - An error if the diff could not be encoded or written, or is incomplete because a namespace failed or the cycle was cut short.
+func writePlanDiff(ctx context.Context, shutdown <-chan struct{}, clientset kubernetes.Interface, namespaces []string, cfg config.Config, baseline resources.Plan, log *logrus.Logger) error {
+	cfg.DryRun = true
+	summary, candidates := prune.Reconcile(ctx, shutdown, clientset, namespaces, cfg, nil, nil, nil, nil, log)
+
+	diff := resources.DiffPlans(baseline, resources.NewPlan(candidates))
+	diff.Log()
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan diff: %w", err)
+	}
+	if _, err := os.Stdout.Write(append(out, '\n')); err != nil {
+		return fmt.Errorf("failed to write plan diff: %w", err)
+	}
+
+	if summary.Failed > 0 || summary.Completed < summary.Namespaces {
+		return fmt.Errorf("plan diff is incomplete, %d of %d namespaces completed", summary.Completed, summary.Namespaces)
 	}
+	utils.LogWithFields(logrus.InfoLevel, []string{fmt.Sprintf("added:%d", len(diff.Added)), fmt.Sprintf("removed:%d", len(diff.Removed))}, "Plan diff written")
+	return nil
 }
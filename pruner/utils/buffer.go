@@ -0,0 +1,98 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flushMu serialises flushes, so the entries of one LogBuffer are never interleaved
+// with those of another.
+var flushMu sync.Mutex
+
+// logBufferKey is the context key a LogBuffer is stored under.
+type logBufferKey struct{}
+
+// logEntry is a log entry held by a LogBuffer until it is flushed.
+type logEntry struct {
+	time    time.Time
+	level   logrus.Level
+	fields  []string
+	message string
+	errs    []error
+}
+
+// LogBuffer collects the log entries made through LogWithFieldsContext, so everything
+// logged while processing one namespace is written contiguously even when several
+// namespaces are processed concurrently.
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+// WithLogBuffer returns a copy of ctx carrying a new LogBuffer, and the buffer itself.
+// The caller must call Flush once done.
+//
+// Parameters:
+// - ctx: The parent context.
+//
+// Returns:
+// - A context carrying the buffer.
+// - A pointer to the new LogBuffer.
+func WithLogBuffer(ctx context.Context) (context.Context, *LogBuffer) {
+	buffer := &LogBuffer{}
+	return context.WithValue(ctx, logBufferKey{}, buffer), buffer
+}
+
+// LogWithFieldsContext logs like LogWithFields, but holds the entry in the LogBuffer
+// carried by ctx, if any, until it is flushed. Fatal entries are never buffered.
+//
+// Parameters:
+// - ctx: The context, optionally carrying a LogBuffer.
+// - level: The log level at which to log the message (e.g., Error, Warn, Info, Debug).
+// - fields: A slice of "key:value" fields to include in the log entry.
+// - message: The message to log.
+// - errs: An optional error to include in the log entry.
+func LogWithFieldsContext(ctx context.Context, level logrus.Level, fields []string, message string, errs ...error) {
+	buffer, buffered := ctx.Value(logBufferKey{}).(*LogBuffer)
+	if !buffered || level == logrus.FatalLevel {
+		LogWithFields(level, fields, message, errs...)
+		return
+	}
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+	buffer.entries = append(buffer.entries, logEntry{time: time.Now(), level: level, fields: fields, message: message, errs: errs})
+}
+
+// Flush writes every buffered entry, in order and with the time it was made, and
+// empties the buffer.
+func (b *LogBuffer) Flush() {
+	b.mu.Lock()
+	entries := b.entries
+	b.entries = nil
+	b.mu.Unlock()
+
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	for _, entry := range entries {
+		logWithFieldsAt(entry.time, entry.level, entry.fields, entry.message, entry.errs...)
+	}
+}
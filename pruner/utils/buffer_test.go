@@ -0,0 +1,46 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogBufferFlushKeepsEntryTime(t *testing.T) {
+	hook := test.NewLocal(Logger())
+	defer Logger().ReplaceHooks(make(logrus.LevelHooks))
+
+	ctx, buffer := WithLogBuffer(context.Background())
+	before := time.Now()
+	LogWithFieldsContext(ctx, logrus.InfoLevel, []string{"pod:web-0"}, "buffered")
+	time.Sleep(10 * time.Millisecond)
+	flushed := time.Now()
+	buffer.Flush()
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "buffered" {
+		t.Fatalf("LastEntry() = %v, want the buffered entry", entry)
+	}
+	if entry.Time.Before(before) || !entry.Time.Before(flushed) {
+		t.Errorf("entry logged at %s, want the time it was buffered, between %s and %s", entry.Time, before, flushed)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 Said Sef
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+// Version is the pod-pruner version, set at build time with
+// -ldflags "-X github.com/saidsef/pod-pruner/pruner/utils.Version=<version>".
+var Version = "dev"
+
+// RecommendedLabels returns the Kubernetes recommended labels identifying pod-pruner,
+// for every object it creates or updates, currently the BUDGET_STATE_CONFIGMAP. Pods it
+// annotates before deleting them belong to their own controllers and must not carry them.
+//
+// Returns:
+// - A new map of label keys to values, safe to modify.
+func RecommendedLabels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "pod-pruner",
+		"app.kubernetes.io/component":  "pruner",
+		"app.kubernetes.io/managed-by": "pod-pruner",
+		"app.kubernetes.io/version":    Version,
+	}
+}
+
+// UserAgent returns the user agent pod-pruner identifies itself with to the Kubernetes API.
+//
+// Returns:
+// - The user agent, in the format "pod-pruner/<version>".
+func UserAgent() string {
+	return "pod-pruner/" + Version
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -77,6 +78,19 @@ func Contains(list []string, str string) bool {
 // Returns:
 // - None. The function logs the message at the specified log level.
 func LogWithFields(level logrus.Level, fields []string, message string, errs ...error) {
+	logWithFieldsAt(time.Time{}, level, fields, message, errs...)
+}
+
+// logWithFieldsAt logs like LogWithFields, timestamping the entry with at instead of
+// the current time, so entries held by a LogBuffer keep the time they were made.
+//
+// Parameters:
+// - at: The time of the entry, zero for the current time.
+// - level: The log level at which to log the message.
+// - fields: A slice of "key:value" fields to include in the log entry.
+// - message: The message to log.
+// - errs: An optional error to include in the log entry.
+func logWithFieldsAt(at time.Time, level logrus.Level, fields []string, message string, errs ...error) {
 	logFields := logrus.Fields{}
 
 	// Convert []string to logrus.Fields
@@ -94,20 +108,25 @@ func LogWithFields(level logrus.Level, fields []string, message string, errs ...
 		logFields["error"] = errs
 	}
 
+	entry := Logger().WithFields(logFields)
+	if !at.IsZero() {
+		entry = entry.WithTime(at)
+	}
+
 	// Log based on the level
 	switch level {
 	case logrus.ErrorLevel:
-		Logger().WithFields(logFields).Error(message)
+		entry.Error(message)
 	case logrus.FatalLevel:
-		Logger().WithFields(logFields).Fatal(message)
+		entry.Fatal(message)
 	case logrus.WarnLevel:
-		Logger().WithFields(logFields).Warn(message)
+		entry.Warn(message)
 	case logrus.DebugLevel:
-		Logger().WithFields(logFields).Debug(message)
+		entry.Debug(message)
 	case logrus.InfoLevel:
-		Logger().WithFields(logFields).Info(message)
+		entry.Info(message)
 	default:
-		Logger().WithFields(logFields).Info(message)
+		entry.Info(message)
 	}
 }
 
@@ -124,3 +143,39 @@ func Logger() *logrus.Logger {
 	})
 	return logger
 }
+
+// IsClosed reports whether the given channel has been closed, without blocking.
+//
+// Parameters:
+// - ch: The channel to check.
+//
+// Returns:
+// - A boolean indicating whether the channel is closed.
+func IsClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Touch sets the modification time of the file at path to now, creating it if it
+// does not exist.
+//
+// Parameters:
+// - path: The path of the file to touch.
+//
+// Returns:
+// - An error if the file could not be created or its modification time updated.
+func Touch(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}